@@ -0,0 +1,65 @@
+package gopssst
+
+import (
+	"encoding/pem"
+	"strconv"
+)
+
+// ArmorType is the label on the BEGIN and END lines of an armored packet.
+const ArmorType = "PSSST PACKET"
+
+func armorHeaders(h PacketHeader) map[string]string {
+	return map[string]string{
+		"Cipher-Suite": strconv.Itoa(int(h.CipherSuite)),
+		"Flags":        flagNames(h.Flags),
+	}
+}
+
+/*
+Armor encodes a packet as text: base64 between BEGIN and END PSSST PACKET lines, with
+Cipher-Suite and Flags headers describing the packet. It is meant for pasting packets
+into tickets, emails and configuration files.
+*/
+func Armor(packetBytes []byte) (armored []byte, err error) {
+	var h PacketHeader
+	if h, err = PeekHeader(packetBytes); err != nil {
+		return
+	}
+
+	armored = pem.EncodeToMemory(&pem.Block{
+		Type:    ArmorType,
+		Headers: armorHeaders(h),
+		Bytes:   packetBytes,
+	})
+
+	return
+}
+
+/*
+Unarmor decodes the first armored packet in text, returning the packet and the text
+following it. The Cipher-Suite and Flags headers are optional, but if present they must
+agree with the packet.
+*/
+func Unarmor(text []byte) (packetBytes []byte, rest []byte, err error) {
+	block, rest := pem.Decode(text)
+	if block == nil || block.Type != ArmorType {
+		err = &PSSSTError{"No armored packet found"}
+		return
+	}
+
+	var h PacketHeader
+	if h, err = PeekHeader(block.Bytes); err != nil {
+		return
+	}
+
+	for name, value := range armorHeaders(h) {
+		if found, ok := block.Headers[name]; ok && found != value {
+			err = &PSSSTError{"Armor header " + name + " does not match packet"}
+			return
+		}
+	}
+
+	packetBytes = block.Bytes
+
+	return
+}
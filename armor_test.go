@@ -0,0 +1,67 @@
+package gopssst
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestArmor(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+
+	outgoingPacket, _, err := client.PackOutgoing([]byte("This is a test!"))
+	if err != nil {
+		t.Fatalf("Packing request packet failed with %s", err)
+	}
+	_, serverReplyHandler, _, err := server.UnpackIncoming(outgoingPacket)
+	if err != nil {
+		t.Fatalf("Unpacking request packet failed with %s", err)
+	}
+	replyPacket, err := serverReplyHandler([]byte("Reply"))
+	if err != nil {
+		t.Fatalf("Packing reply packet failed with %s", err)
+	}
+
+	armored, err := Armor(replyPacket)
+	if err != nil {
+		t.Fatalf("Armor failed with %s", err)
+	}
+	for _, expected := range []string{"-----BEGIN PSSST PACKET-----", "Cipher-Suite: 1", "Flags: reply"} {
+		if !strings.Contains(string(armored), expected) {
+			t.Errorf("Armored packet did not contain %q:\n%s", expected, armored)
+		}
+	}
+
+	// Surrounding text, as in an email, should be ignored
+	text := append([]byte("See the reply below.\n\n"), armored...)
+	text = append(text, "Thanks\n"...)
+
+	unarmored, rest, err := Unarmor(text)
+	if err != nil {
+		t.Fatalf("Unarmor failed with %s", err)
+	}
+	if !bytes.Equal(unarmored, replyPacket) {
+		t.Errorf("Unarmored packet did not match")
+	}
+	if string(rest) != "Thanks\n" {
+		t.Errorf("Unexpected rest %q", rest)
+	}
+
+	tampered := bytes.Replace(armored, []byte("Flags: reply"), []byte("Flags: none"), 1)
+	if _, _, err = Unarmor(tampered); err == nil {
+		t.Errorf("Unarmor accepted mismatched flags")
+	}
+
+	if _, _, err = Unarmor([]byte("no packet here")); err == nil {
+		t.Errorf("Unarmor accepted text without a packet")
+	}
+	if _, err = Armor(replyPacket[:10]); err == nil {
+		t.Errorf("Armor accepted a truncated packet")
+	}
+}
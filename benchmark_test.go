@@ -0,0 +1,120 @@
+package gopssst
+
+import (
+	"fmt"
+	"testing"
+)
+
+// The benchmarks in this file run every stage of an exchange across a range of payload
+// sizes, with and without client auth, and always report allocations. Run them with:
+//
+//	go test -run XXX -bench Suite
+
+var benchmarkPayloadSizes = []int{16, 256, 1024, 8192}
+
+type benchmarkSetup struct {
+	server  Server
+	client  Client
+	payload []byte
+}
+
+func newBenchmarkSetup(b *testing.B, clientAuth bool, size int) *benchmarkSetup {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		b.Fatalf("Generate server key failed with %s", err)
+	}
+
+	var clientPrivateKey interface{}
+	if clientAuth {
+		if clientPrivateKey, _, err = GenerateKeyPair(CipherSuiteX25519AESGCM, nil); err != nil {
+			b.Fatalf("Generate client key failed with %s", err)
+		}
+	}
+
+	server, err := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	if err != nil {
+		b.Fatalf("Creating server failed with %s", err)
+	}
+	client, err := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, clientPrivateKey)
+	if err != nil {
+		b.Fatalf("Creating client failed with %s", err)
+	}
+
+	return &benchmarkSetup{server, client, make([]byte, size)}
+}
+
+func runBenchmarkSuite(b *testing.B, stage func(b *testing.B, setup *benchmarkSetup)) {
+	for _, clientAuth := range []bool{false, true} {
+		for _, size := range benchmarkPayloadSizes {
+			name := fmt.Sprintf("auth=%t/size=%d", clientAuth, size)
+			b.Run(name, func(b *testing.B) {
+				setup := newBenchmarkSetup(b, clientAuth, size)
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				stage(b, setup)
+			})
+		}
+	}
+}
+
+func BenchmarkSuitePack(b *testing.B) {
+	runBenchmarkSuite(b, func(b *testing.B, setup *benchmarkSetup) {
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := setup.client.PackOutgoing(setup.payload); err != nil {
+				b.Fatalf("Making request packet failed with: %s", err)
+			}
+		}
+	})
+}
+
+func BenchmarkSuiteUnpack(b *testing.B) {
+	runBenchmarkSuite(b, func(b *testing.B, setup *benchmarkSetup) {
+		packets := make([][]byte, b.N)
+		for i := range packets {
+			var err error
+			if packets[i], _, err = setup.client.PackOutgoing(setup.payload); err != nil {
+				b.Fatalf("Making request packet failed with: %s", err)
+			}
+		}
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, _, _, err := setup.server.UnpackIncoming(packets[i]); err != nil {
+				b.Fatalf("Unpacking request packet failed with: %s", err)
+			}
+		}
+	})
+}
+
+// BenchmarkSuiteUnpackAndReply times the server's whole side of an exchange, since each reply handler can only be used once.
+func BenchmarkSuiteUnpackAndReply(b *testing.B) {
+	runBenchmarkSuite(b, func(b *testing.B, setup *benchmarkSetup) {
+		packets := make([][]byte, b.N)
+		for i := range packets {
+			var err error
+			if packets[i], _, err = setup.client.PackOutgoing(setup.payload); err != nil {
+				b.Fatalf("Making request packet failed with: %s", err)
+			}
+		}
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			data, replyHandler, _, err := setup.server.UnpackIncoming(packets[i])
+			if err != nil {
+				b.Fatalf("Unpacking request packet failed with: %s", err)
+			}
+			if _, err = replyHandler(data); err != nil {
+				b.Fatalf("Making reply packet failed with: %s", err)
+			}
+		}
+	})
+}
+
+// BenchmarkSuitePackAndUnpackReply times the client's whole side of an exchange, for the same reason.
+func BenchmarkSuitePackAndUnpackReply(b *testing.B) {
+	runBenchmarkSuite(b, func(b *testing.B, setup *benchmarkSetup) {
+		b.ResetTimer()
+		benchmarkPackAndUnpackReply(b, setup.client, setup.server, setup.payload)
+	})
+}
@@ -0,0 +1,237 @@
+// Copyright 2018 Nicko van Someren
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Command libpssst is built as a C shared library exposing the C API declared in pssst.h,
+so that programs in other languages can use this implementation of PSSST:
+
+	go build -buildmode=c-shared -o libpssst.so ./cmd/libpssst
+*/
+package main
+
+/*
+#include <stddef.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/nickovs/gopssst/flat"
+)
+
+// Return codes, matching pssst.h
+const (
+	pssstOK                 = 0
+	pssstErrInvalidArgument = -1
+	pssstErrBadHandle       = -2
+	pssstErrBufferTooSmall  = -3
+	pssstErrFailed          = -4
+)
+
+const keySize = 32
+
+// replyOverhead is the size of a reply packet beyond its data.
+const replyOverhead = 52
+
+// result maps an error from the flat API onto a return code.
+func result(err error) C.int {
+	switch err {
+	case nil:
+		return pssstOK
+	case flat.ErrBadHandle:
+		return pssstErrBadHandle
+	}
+	return pssstErrFailed
+}
+
+func goBytes(p *C.uint8_t, length C.size_t) []byte {
+	if length == 0 {
+		return []byte{}
+	}
+	return C.GoBytes(unsafe.Pointer(p), C.int(length))
+}
+
+// copyOut copies b to a caller buffer, reporting the length needed if it does not fit.
+func copyOut(b []byte, out *C.uint8_t, capacity C.size_t, length *C.size_t) C.int {
+	*length = C.size_t(len(b))
+	if C.size_t(len(b)) > capacity {
+		return pssstErrBufferTooSmall
+	}
+	if len(b) > 0 {
+		copy((*[1 << 30]byte)(unsafe.Pointer(out))[:len(b):len(b)], b)
+	}
+	return pssstOK
+}
+
+//export pssst_keygen
+func pssst_keygen(privateKey *C.uint8_t, publicKey *C.uint8_t) C.int {
+	if privateKey == nil || publicKey == nil {
+		return pssstErrInvalidArgument
+	}
+
+	private, public, err := flat.GenerateKeyPair()
+	if err != nil {
+		return result(err)
+	}
+
+	var length C.size_t
+	copyOut(private, privateKey, keySize, &length)
+	copyOut(public, publicKey, keySize, &length)
+	return pssstOK
+}
+
+//export pssst_client_new
+func pssst_client_new(serverPublicKey *C.uint8_t, clientPrivateKey *C.uint8_t, client *C.uint64_t) C.int {
+	if serverPublicKey == nil || client == nil {
+		return pssstErrInvalidArgument
+	}
+
+	var privateKey []byte
+	if clientPrivateKey != nil {
+		privateKey = goBytes(clientPrivateKey, keySize)
+	}
+
+	c, err := flat.ClientNew(goBytes(serverPublicKey, keySize), privateKey)
+	if err != nil {
+		return result(err)
+	}
+
+	*client = C.uint64_t(c)
+	return pssstOK
+}
+
+//export pssst_pack
+func pssst_pack(client C.uint64_t, data *C.uint8_t, dataLen C.size_t, packet *C.uint8_t, packetCap C.size_t, packetLen *C.size_t, request *C.uint64_t) C.int {
+	if (data == nil && dataLen != 0) || packetLen == nil || request == nil {
+		return pssstErrInvalidArgument
+	}
+
+	packetBytes, r, err := flat.Pack(flat.Handle(client), goBytes(data, dataLen))
+	if err != nil {
+		return result(err)
+	}
+
+	if code := copyOut(packetBytes, packet, packetCap, packetLen); code != pssstOK {
+		flat.Free(r)
+		return code
+	}
+
+	*request = C.uint64_t(r)
+	return pssstOK
+}
+
+//export pssst_unpack_reply
+func pssst_unpack_reply(request C.uint64_t, packet *C.uint8_t, packetLen C.size_t, data *C.uint8_t, dataCap C.size_t, dataLen *C.size_t) C.int {
+	if packet == nil || dataLen == nil {
+		return pssstErrInvalidArgument
+	}
+
+	// The reply can only be unpacked once, so check the buffer before trying, but only
+	// once the handle is known to be good so that a bad one is reported as such
+	if !flat.IsRequest(flat.Handle(request)) {
+		return pssstErrBadHandle
+	}
+	if packetLen >= replyOverhead && packetLen-replyOverhead > dataCap {
+		*dataLen = packetLen - replyOverhead
+		return pssstErrBufferTooSmall
+	}
+
+	replyData, err := flat.UnpackReply(flat.Handle(request), goBytes(packet, packetLen))
+	if err != nil {
+		return result(err)
+	}
+
+	return copyOut(replyData, data, dataCap, dataLen)
+}
+
+//export pssst_server_new
+func pssst_server_new(serverPrivateKey *C.uint8_t, server *C.uint64_t) C.int {
+	if serverPrivateKey == nil || server == nil {
+		return pssstErrInvalidArgument
+	}
+
+	s, err := flat.ServerNew(goBytes(serverPrivateKey, keySize))
+	if err != nil {
+		return result(err)
+	}
+
+	*server = C.uint64_t(s)
+	return pssstOK
+}
+
+//export pssst_unpack
+func pssst_unpack(server C.uint64_t, packet *C.uint8_t, packetLen C.size_t, data *C.uint8_t, dataCap C.size_t, dataLen *C.size_t, clientPublicKey *C.uint8_t, clientAuth *C.int, reply *C.uint64_t) C.int {
+	if packet == nil || dataLen == nil || reply == nil {
+		return pssstErrInvalidArgument
+	}
+
+	requestData, clientKey, r, err := flat.Unpack(flat.Handle(server), goBytes(packet, packetLen))
+	if err != nil {
+		return result(err)
+	}
+
+	// Unpacking is stateless, so if the buffer is too small the caller can simply retry
+	if code := copyOut(requestData, data, dataCap, dataLen); code != pssstOK {
+		flat.Free(r)
+		return code
+	}
+
+	if clientAuth != nil {
+		*clientAuth = 0
+	}
+	if clientKey != nil {
+		if clientAuth != nil {
+			*clientAuth = 1
+		}
+		if clientPublicKey != nil {
+			var length C.size_t
+			copyOut(clientKey, clientPublicKey, keySize, &length)
+		}
+	}
+
+	*reply = C.uint64_t(r)
+	return pssstOK
+}
+
+//export pssst_reply
+func pssst_reply(reply C.uint64_t, data *C.uint8_t, dataLen C.size_t, packet *C.uint8_t, packetCap C.size_t, packetLen *C.size_t) C.int {
+	if (data == nil && dataLen != 0) || packetLen == nil {
+		return pssstErrInvalidArgument
+	}
+
+	// As with replies at the client, a reply can only be packed once so check the buffer first
+	if !flat.IsReply(flat.Handle(reply)) {
+		return pssstErrBadHandle
+	}
+	if dataLen+replyOverhead > packetCap {
+		*packetLen = dataLen + replyOverhead
+		return pssstErrBufferTooSmall
+	}
+
+	replyPacket, err := flat.Reply(flat.Handle(reply), goBytes(data, dataLen))
+	if err != nil {
+		return result(err)
+	}
+
+	return copyOut(replyPacket, packet, packetCap, packetLen)
+}
+
+//export pssst_free
+func pssst_free(handle C.uint64_t) {
+	flat.Free(flat.Handle(handle))
+}
+
+func main() {}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2018 Nicko van Someren
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+/*
+ * C API for libpssst, built with:
+ *
+ *     go build -buildmode=c-shared -o libpssst.so ./cmd/libpssst
+ *
+ * Keys are raw 32 byte X25519 keys. Clients, servers, pending requests and
+ * pending replies are referred to by opaque non-zero handles. A request handle
+ * is released when pssst_unpack_reply succeeds and a reply handle when
+ * pssst_reply succeeds; otherwise handles must be released with pssst_free.
+ * All output buffers are supplied by the caller; if one is too small
+ * PSSST_ERR_BUFFER_TOO_SMALL is returned and the required size is stored in
+ * the length output.
+ */
+
+#ifndef PSSST_H
+#define PSSST_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+#define PSSST_KEY_SIZE 32
+
+/* The most a request packet can exceed its data by, with client auth. */
+#define PSSST_REQUEST_OVERHEAD 116
+/* How much a reply packet exceeds its data by. */
+#define PSSST_REPLY_OVERHEAD 52
+
+#define PSSST_OK 0
+#define PSSST_ERR_INVALID_ARGUMENT -1
+#define PSSST_ERR_BAD_HANDLE -2
+#define PSSST_ERR_BUFFER_TOO_SMALL -3
+#define PSSST_ERR_FAILED -4
+
+typedef uint64_t pssst_handle;
+
+int pssst_keygen(uint8_t private_key[PSSST_KEY_SIZE], uint8_t public_key[PSSST_KEY_SIZE]);
+
+/* client_private_key may be NULL for an anonymous client. */
+int pssst_client_new(const uint8_t server_public_key[PSSST_KEY_SIZE],
+                     const uint8_t *client_private_key, pssst_handle *client);
+
+int pssst_pack(pssst_handle client, const uint8_t *data, size_t data_len,
+               uint8_t *packet, size_t packet_cap, size_t *packet_len,
+               pssst_handle *request);
+
+int pssst_unpack_reply(pssst_handle request, const uint8_t *packet, size_t packet_len,
+                       uint8_t *data, size_t data_cap, size_t *data_len);
+
+int pssst_server_new(const uint8_t server_private_key[PSSST_KEY_SIZE], pssst_handle *server);
+
+/* client_public_key may be NULL; *client_auth is set to 1 if the client authenticated. */
+int pssst_unpack(pssst_handle server, const uint8_t *packet, size_t packet_len,
+                 uint8_t *data, size_t data_cap, size_t *data_len,
+                 uint8_t *client_public_key, int *client_auth, pssst_handle *reply);
+
+int pssst_reply(pssst_handle reply, const uint8_t *data, size_t data_len,
+                uint8_t *packet, size_t packet_cap, size_t *packet_len);
+
+/* Releases any handle. Releasing an unknown handle is ignored. */
+void pssst_free(pssst_handle handle);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nickovs/gopssst"
+)
+
+type benchResult struct {
+	latencies []time.Duration
+	lost      int
+	failed    int
+}
+
+func bench(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	serverKeyFile := flags.String("key", "", "server public key `file`; if not set a loopback echo server is started")
+	clientKeyFile := flags.String("client-key", "", "client private key `file` or key store, to authenticate the client")
+	address := flags.String("server", "localhost:4242", "server UDP `address`")
+	concurrency := flags.Int("concurrency", 8, "number of concurrent clients")
+	size := flags.Int("size", 64, "request payload size in `bytes`")
+	duration := flags.Duration("duration", 10*time.Second, "length of the run")
+	timeout := flags.Duration("timeout", time.Second, "time after which a request is counted as lost")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pssst bench [-key server.pub -server address] [-concurrency n] [-size bytes] [-duration d]\n\n")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 || *concurrency < 1 || *size < 0 {
+		flags.Usage()
+		return fmt.Errorf("invalid arguments")
+	}
+
+	var client gopssst.Client
+	var err error
+
+	if *serverKeyFile == "" {
+		var serverConn net.PacketConn
+		if client, serverConn, err = loopbackServer(*clientKeyFile); err != nil {
+			return err
+		}
+		defer serverConn.Close()
+		*address = serverConn.LocalAddr().String()
+	} else if client, err = newClient(*serverKeyFile, *clientKeyFile); err != nil {
+		return err
+	}
+
+	payload := make([]byte, *size)
+	results := make([]benchResult, *concurrency)
+	deadline := time.Now().Add(*duration)
+
+	var wg sync.WaitGroup
+	wg.Add(*concurrency)
+	start := time.Now()
+
+	for i := range results {
+		go func(r *benchResult) {
+			defer wg.Done()
+
+			conn, err := net.Dial("udp", *address)
+			if err != nil {
+				r.failed++
+				return
+			}
+			defer conn.Close()
+
+			buf := make([]byte, maxDatagramSize)
+			for time.Now().Before(deadline) {
+				sent := time.Now()
+				lost, err := benchExchange(conn, client, payload, buf, sent.Add(*timeout))
+				switch {
+				case lost:
+					r.lost++
+				case err != nil:
+					r.failed++
+				default:
+					r.latencies = append(r.latencies, time.Since(sent))
+				}
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	var latencies []time.Duration
+	var lost, failed int
+	for _, r := range results {
+		latencies = append(latencies, r.latencies...)
+		lost += r.lost
+		failed += r.failed
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	total := len(latencies) + lost + failed
+	fmt.Printf("Requests:   %d in %s (%d concurrent, %d byte payload)\n", total, elapsed.Round(time.Millisecond), *concurrency, *size)
+	fmt.Printf("Throughput: %.1f replies/s\n", float64(len(latencies))/elapsed.Seconds())
+	if total > 0 {
+		fmt.Printf("Lost:       %d (%.2f%%)\n", lost, 100*float64(lost)/float64(total))
+	}
+	if failed > 0 {
+		fmt.Printf("Failed:     %d\n", failed)
+	}
+	if len(latencies) > 0 {
+		fmt.Printf("Latency:    p50 %s  p90 %s  p99 %s  max %s\n",
+			percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99), latencies[len(latencies)-1])
+	}
+
+	return nil
+}
+
+/*
+benchExchange sends a single request and waits for its reply until deadline. Unlike
+Exchange it never retransmits, so that a missing reply can be counted as lost. Late
+replies to earlier requests are skipped.
+*/
+func benchExchange(conn net.Conn, client gopssst.Client, data, buf []byte, deadline time.Time) (lost bool, err error) {
+	packetBytes, replyHandler, err := client.PackOutgoing(data)
+	if err != nil {
+		return
+	}
+	if _, err = conn.Write(packetBytes); err != nil {
+		return
+	}
+	if err = conn.SetReadDeadline(deadline); err != nil {
+		return
+	}
+
+	for {
+		var n int
+		if n, err = conn.Read(buf); err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				lost = true
+			}
+			return
+		}
+		if n >= 36 && bytes.Equal(buf[4:36], packetBytes[4:36]) {
+			_, err = replyHandler(buf[:n])
+			return
+		}
+	}
+}
+
+// percentile returns the p-th percentile of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+/*
+loopbackServer starts an echo server with a fresh key on a local port and returns a client
+for it. The client key file or key store is looked up just as it is for a real server.
+*/
+func loopbackServer(clientKeyFile string) (client gopssst.Client, conn net.PacketConn, err error) {
+	serverPrivateKey, serverPublicKey, err := gopssst.GenerateKeyPair(gopssst.CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		return
+	}
+
+	server, err := gopssst.NewServer(gopssst.CipherSuiteX25519AESGCM, serverPrivateKey)
+	if err != nil {
+		return
+	}
+
+	if client, err = newClientFor(serverPublicKey.([]byte), clientKeyFile); err != nil {
+		return
+	}
+
+	if conn, err = net.ListenPacket("udp", "127.0.0.1:0"); err != nil {
+		return
+	}
+
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, addr, err := readDatagram(conn, buf)
+			if err != nil {
+				return
+			}
+			data, replyHandler, _, err := server.UnpackIncoming(buf[:n])
+			if err != nil {
+				continue
+			}
+			if reply, err := replyHandler(data); err == nil {
+				conn.WriteTo(reply, addr)
+			}
+		}
+	}()
+
+	return
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nickovs/gopssst"
+)
+
+func TestLoopbackServerKeyStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pssst")
+	if err != nil {
+		t.Fatalf("Creating temporary directory failed with %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	clientPrivateKey, _, err := gopssst.GenerateKeyPair(gopssst.CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate client key failed with %s", err)
+	}
+	identity, err := gopssst.NewClientIdentity(gopssst.CipherSuiteX25519AESGCM, clientPrivateKey)
+	if err != nil {
+		t.Fatalf("Creating client identity failed with %s", err)
+	}
+	store := filepath.Join(dir, "store")
+	if err = gopssst.NewKeyStore(store).Store(identity); err != nil {
+		t.Fatalf("Storing client identity failed with %s", err)
+	}
+
+	client, serverConn, err := loopbackServer(store)
+	if err != nil {
+		t.Fatalf("Starting loopback server with a key store failed with %s", err)
+	}
+	defer serverConn.Close()
+
+	conn, err := net.Dial("udp", serverConn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial failed with %s", err)
+	}
+	defer conn.Close()
+
+	reply, err := gopssst.Exchange(conn, client, []byte("Telemetry"), time.Second, 3)
+	if err != nil {
+		t.Fatalf("Exchange failed with %s", err)
+	}
+	if !bytes.Equal(reply, []byte("Telemetry")) {
+		t.Errorf("Loopback server did not echo the request")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/nickovs/gopssst"
+)
+
+// suiteNames must list every cipher suite constant in the library.
+var suiteNames = map[uint16]string{
+	gopssst.CipherSuiteX25519AESGCM: "X25519-AESGCM128",
+}
+
+type dissectorFlag struct {
+	Field, Name string
+	Mask        uint16
+	// Position counts from the most significant bit, as used by TvbRange:bitfield
+	Position int
+}
+
+/*
+dissectorFlags finds the bit for each known flag by asking PacketHeader about every
+bit in turn, so the dissector is generated from the library's own definitions.
+*/
+func dissectorFlags() []dissectorFlag {
+	var flags []dissectorFlag
+	for bit := 15; bit >= 0; bit-- {
+		h := gopssst.PacketHeader{Flags: 1 << bit}
+		if h.IsReply() {
+			flags = append(flags, dissectorFlag{"reply", "Reply", h.Flags, 15 - bit})
+		}
+		if h.HasClientAuth() {
+			flags = append(flags, dissectorFlag{"client_auth", "Client auth", h.Flags, 15 - bit})
+		}
+	}
+	return flags
+}
+
+var dissectorTemplate = template.Must(template.New("dissector").Parse(`-- Wireshark dissector for PSSST, generated by "pssst dissector".
+-- Install by copying into the Wireshark personal plugins directory.
+
+local pssst = Proto("pssst", "Packet Security for Stateless Server Transactions")
+
+local suites = {
+{{- range $suite, $name := .Suites}}
+  [{{$suite}}] = "{{$name}}",
+{{- end}}
+}
+
+local f_flags = ProtoField.uint16("pssst.flags", "Flags", base.HEX)
+{{- range .Flags}}
+local f_{{.Field}} = ProtoField.bool("pssst.flags.{{.Field}}", "{{.Name}}", 16, nil, {{printf "0x%04x" .Mask}})
+{{- end}}
+local f_suite = ProtoField.uint16("pssst.suite", "Cipher suite", base.DEC, suites)
+local f_dh_param = ProtoField.bytes("pssst.dh_param", "DH param")
+local f_ciphertext = ProtoField.bytes("pssst.ciphertext", "Ciphertext")
+local f_tag = ProtoField.bytes("pssst.tag", "AEAD tag")
+
+pssst.fields = { f_flags,{{range .Flags}} f_{{.Field}},{{end}} f_suite, f_dh_param, f_ciphertext, f_tag }
+
+function pssst.dissector(buffer, pinfo, tree)
+  if buffer:len() < {{.HeaderSize}} then
+    return 0
+  end
+
+  pinfo.cols.protocol = "PSSST"
+
+  local subtree = tree:add(pssst, buffer(), "PSSST")
+  local flags = buffer(0, 2)
+  local flags_tree = subtree:add(f_flags, flags)
+{{- range .Flags}}
+  flags_tree:add(f_{{.Field}}, flags)
+{{- end}}
+  subtree:add(f_suite, buffer(2, 2))
+  subtree:add(f_dh_param, buffer(4, 32))
+
+  local ciphertext_length = buffer:len() - {{.HeaderSize}}
+  if ciphertext_length > {{.TagSize}} then
+    subtree:add(f_ciphertext, buffer({{.HeaderSize}}, ciphertext_length - {{.TagSize}}))
+  end
+  if ciphertext_length >= {{.TagSize}} then
+    subtree:add(f_tag, buffer(buffer:len() - {{.TagSize}}, {{.TagSize}}))
+  elseif ciphertext_length > 0 then
+    subtree:add(f_ciphertext, buffer({{.HeaderSize}}, ciphertext_length))
+  end
+
+  if flags:bitfield({{.ReplyPosition}}, 1) == 1 then
+    pinfo.cols.info = "Reply"
+  else
+    pinfo.cols.info = "Request"
+  end
+
+  return buffer:len()
+end
+
+local udp_port = DissectorTable.get("udp.port")
+{{- range .Ports}}
+udp_port:add({{.}}, pssst)
+{{- end}}
+`))
+
+func dissector(args []string) error {
+	flags := flag.NewFlagSet("dissector", flag.ExitOnError)
+	ports := flags.String("ports", "4242", "comma separated UDP `ports` to decode as PSSST")
+	out := flags.String("out", "-", "output `file`")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pssst dissector [-ports list] [-out file]\n\n")
+		fmt.Fprintf(flags.Output(), "Writes a Wireshark Lua dissector for the current packet layout.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments")
+	}
+
+	var portList []int
+	for _, port := range strings.Split(*ports, ",") {
+		p, err := strconv.Atoi(strings.TrimSpace(port))
+		if err != nil || p < 1 || p > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+		portList = append(portList, p)
+	}
+
+	data := struct {
+		Suites        map[uint16]string
+		Flags         []dissectorFlag
+		ReplyPosition int
+		HeaderSize    int
+		TagSize       int
+		Ports         []int
+	}{
+		Suites:     suiteNames,
+		Flags:      dissectorFlags(),
+		HeaderSize: 36,
+		TagSize:    16,
+		Ports:      portList,
+	}
+	for _, f := range data.Flags {
+		if f.Field == "reply" {
+			data.ReplyPosition = f.Position
+		}
+	}
+
+	var b strings.Builder
+	if err := dissectorTemplate.Execute(&b, data); err != nil {
+		return err
+	}
+
+	return writeOutput(*out, []byte(b.String()))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nickovs/gopssst"
+)
+
+func inspect(args []string) error {
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	serverKeyFile := flags.String("key", "", "server private key `file`, to decrypt request packets")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pssst inspect [-key server] <file|hex|->\n\n")
+		fmt.Fprintf(flags.Output(), "The packet can be a file holding a raw or armored packet, \"-\" for stdin, or hex on the command line.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("a packet is required")
+	}
+
+	packetBytes, err := readPacket(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *serverKeyFile == "" {
+		fmt.Print(gopssst.Dump(packetBytes))
+		return nil
+	}
+
+	serverPrivateKey, err := readKey(*serverKeyFile, true)
+	if err != nil {
+		return err
+	}
+	server, err := gopssst.NewServer(gopssst.CipherSuiteX25519AESGCM, serverPrivateKey)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(gopssst.DumpDecrypted(packetBytes, server))
+	return nil
+}
+
+// readPacket reads a packet from a file or stdin, or decodes it from hex if no such file exists.
+func readPacket(source string) ([]byte, error) {
+	packetBytes, err := readInput(source)
+	if os.IsNotExist(err) {
+		if packetBytes, err = hex.DecodeString(strings.Join(strings.Fields(source), "")); err != nil {
+			return nil, fmt.Errorf("%s is neither a file nor a hex packet", source)
+		}
+		return packetBytes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return unarmorPacket(packetBytes)
+}
+
+// unarmorPacket returns the packet inside an armored block, or the input unchanged if it is not armored.
+func unarmorPacket(packetBytes []byte) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(packetBytes), []byte("-----BEGIN")) {
+		return packetBytes, nil
+	}
+	packetBytes, _, err := gopssst.Unarmor(packetBytes)
+	return packetBytes, err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/nickovs/gopssst"
+)
+
+func keygen(args []string) error {
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	format := flags.String("format", formatHex, "key `format`: hex, raw, pem or bech32")
+	out := flags.String("out", "", "write the private key to `file` and the public key to file.pub")
+	store := flags.String("store", "", "write the private key to the power-loss-safe key store at `path` instead")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pssst keygen [-format format] [-out file] [-store path]\n\n")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments")
+	}
+
+	if *out != "" && *store != "" {
+		return fmt.Errorf("only one of -out and -store may be given")
+	}
+	if *out == "" && *format == formatRaw {
+		return fmt.Errorf("raw keys can only be written to a file")
+	}
+
+	privateKey, publicKey, err := gopssst.GenerateKeyPair(gopssst.CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		return err
+	}
+	privateKeyBytes := privateKey.([]byte)
+	publicKeyBytes := publicKey.([]byte)
+
+	privateEncoded, err := encodeKey(privateKeyBytes, true, gopssst.CipherSuiteX25519AESGCM, *format)
+	if err != nil {
+		return err
+	}
+	publicEncoded, err := encodeKey(publicKeyBytes, false, gopssst.CipherSuiteX25519AESGCM, *format)
+	if err != nil {
+		return err
+	}
+
+	if *store != "" {
+		identity, err := gopssst.NewClientIdentity(gopssst.CipherSuiteX25519AESGCM, privateKeyBytes)
+		if err != nil {
+			return err
+		}
+		if err = gopssst.NewKeyStore(*store).Store(identity); err != nil {
+			return err
+		}
+		os.Stdout.Write(publicEncoded)
+	} else if *out == "" {
+		os.Stdout.Write(privateEncoded)
+		os.Stdout.Write(publicEncoded)
+	} else {
+		if err = ioutil.WriteFile(*out, privateEncoded, 0600); err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(*out+".pub", publicEncoded, 0644); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Fingerprint: %s\n", fingerprint(publicKeyBytes))
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Key formats supported for reading and writing keys.
+const (
+	formatHex    = "hex"
+	formatRaw    = "raw"
+	formatPEM    = "pem"
+	formatBech32 = "bech32"
+)
+
+const (
+	pemPrivateKeyType = "PSSST PRIVATE KEY"
+	pemPublicKeyType  = "PSSST PUBLIC KEY"
+
+	bech32PrivateKeyHRP = "pssstsec"
+	bech32PublicKeyHRP  = "pssstpub"
+)
+
+// encodeKey encodes a key in the given format. The raw format is the bare key bytes.
+func encodeKey(key []byte, private bool, cipherSuite int, format string) ([]byte, error) {
+	switch format {
+	case formatHex:
+		return []byte(hex.EncodeToString(key) + "\n"), nil
+	case formatRaw:
+		return key, nil
+	case formatPEM:
+		block := &pem.Block{
+			Type:    pemPublicKeyType,
+			Headers: map[string]string{"Cipher-Suite": strconv.Itoa(cipherSuite)},
+			Bytes:   key,
+		}
+		if private {
+			block.Type = pemPrivateKeyType
+		}
+		return pem.EncodeToMemory(block), nil
+	case formatBech32:
+		hrp := bech32PublicKeyHRP
+		if private {
+			hrp = bech32PrivateKeyHRP
+		}
+		encoded, err := bech32Encode(hrp, key)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(encoded + "\n"), nil
+	}
+	return nil, fmt.Errorf("unknown key format %q", format)
+}
+
+// fingerprint returns a short identifier for a public key, in the style of OpenSSH.
+func fingerprint(publicKey []byte) string {
+	sum := sha256.Sum256(publicKey)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// Bech32 as specified in BIP-173.
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 != 0 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+// convertBits regroups a slice of fromBits-bit values into toBits-bit values.
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	maxValue := uint32(1)<<toBits - 1
+	var out []byte
+
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, fmt.Errorf("invalid data value %d", v)
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxValue))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(toBits-bits)&maxValue))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxValue != 0 {
+		return nil, fmt.Errorf("invalid padding")
+	}
+
+	return out, nil
+}
+
+func bech32Encode(hrp string, data []byte) (string, error) {
+	values, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	checksumInput := append(bech32HRPExpand(hrp), values...)
+	checksumInput = append(checksumInput, 0, 0, 0, 0, 0, 0)
+	polymod := bech32Polymod(checksumInput) ^ 1
+
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, v := range values {
+		b.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+
+	return b.String(), nil
+}
+
+func bech32Decode(encoded string) (hrp string, data []byte, err error) {
+	if strings.ToLower(encoded) != encoded && strings.ToUpper(encoded) != encoded {
+		return "", nil, fmt.Errorf("mixed case bech32 string")
+	}
+	encoded = strings.ToLower(encoded)
+
+	separator := strings.LastIndexByte(encoded, '1')
+	if separator < 1 || separator+7 > len(encoded) {
+		return "", nil, fmt.Errorf("invalid bech32 separator position")
+	}
+	hrp = encoded[:separator]
+
+	values := make([]byte, 0, len(encoded)-separator-1)
+	for i := separator + 1; i < len(encoded); i++ {
+		v := strings.IndexByte(bech32Charset, encoded[i])
+		if v < 0 {
+			return "", nil, fmt.Errorf("invalid bech32 character %q", encoded[i])
+		}
+		values = append(values, byte(v))
+	}
+
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != 1 {
+		return "", nil, fmt.Errorf("invalid bech32 checksum")
+	}
+
+	data, err = convertBits(values[:len(values)-6], 5, 8, false)
+	return
+}
+
+/*
+decodeKey decodes a key written in any of the supported formats, which are told apart
+by their contents.
+*/
+func decodeKey(encoded []byte, private bool) ([]byte, error) {
+	if len(encoded) == 32 {
+		return encoded, nil
+	}
+
+	wantType, wantHRP := pemPublicKeyType, bech32PublicKeyHRP
+	if private {
+		wantType, wantHRP = pemPrivateKeyType, bech32PrivateKeyHRP
+	}
+
+	text := strings.TrimSpace(string(encoded))
+	var key []byte
+
+	switch {
+	case strings.HasPrefix(text, "-----BEGIN"):
+		block, _ := pem.Decode([]byte(text))
+		if block == nil {
+			return nil, fmt.Errorf("invalid PEM key")
+		}
+		if block.Type != wantType {
+			return nil, fmt.Errorf("expected %s, found %s", wantType, block.Type)
+		}
+		key = block.Bytes
+	case strings.HasPrefix(strings.ToLower(text), "pssst"):
+		hrp, data, err := bech32Decode(text)
+		if err != nil {
+			return nil, err
+		}
+		if hrp != wantHRP {
+			return nil, fmt.Errorf("expected %s key, found %s", wantHRP, hrp)
+		}
+		key = data
+	default:
+		var err error
+		if key, err = hex.DecodeString(text); err != nil {
+			return nil, fmt.Errorf("unrecognised key format")
+		}
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("wrong key length %d", len(key))
+	}
+
+	return key, nil
+}
+
+// readKey reads a key file written in any of the supported formats.
+func readKey(path string, private bool) ([]byte, error) {
+	encoded, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := decodeKey(encoded, private)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return key, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBech32Vectors(t *testing.T) {
+	// Valid checksums from BIP-173
+	valid := []string{
+		"A12UEL5L",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+	}
+	for _, s := range valid {
+		if _, _, err := bech32Decode(s); err != nil {
+			t.Errorf("Decoding %s failed with %s", s, err)
+		}
+	}
+
+	invalid := []string{
+		"pzry9x0s0muk",
+		"1pzry9x0s0muk",
+		"x1b4n0q5v",
+		"li1dgmt3",
+		"A1G7SGD8",
+		"10a06t8",
+		"1qzzfhee",
+		"a12UEL5L",
+	}
+	for _, s := range invalid {
+		if _, _, err := bech32Decode(s); err == nil {
+			t.Errorf("Decoding %s succeeded", s)
+		}
+	}
+}
+
+func TestBech32Roundtrip(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i * 7)
+	}
+
+	encoded, err := bech32Encode(bech32PublicKeyHRP, key)
+	if err != nil {
+		t.Fatalf("Encoding failed with %s", err)
+	}
+
+	hrp, decoded, err := bech32Decode(encoded)
+	if err != nil {
+		t.Fatalf("Decoding failed with %s", err)
+	}
+	if hrp != bech32PublicKeyHRP {
+		t.Errorf("Wrong HRP %q", hrp)
+	}
+	if !bytes.Equal(decoded, key) {
+		t.Errorf("Decoded key did not match")
+	}
+}
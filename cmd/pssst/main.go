@@ -0,0 +1,182 @@
+// Copyright 2018 Nicko van Someren
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SPDX-License-Identifier: Apache-2.0
+
+/*
+Command pssst provides tools for working with PSSST keys and packets.
+
+Usage:
+
+	pssst <command> [arguments]
+
+Run "pssst help" for the list of commands.
+
+Any flag not given on the command line can be set with an environment variable named
+PSSST_<COMMAND>_<FLAG>, with dashes replaced by underscores. For instance
+PSSST_SERVE_LISTEN sets the -listen flag of the serve command.
+
+Every command also takes a -config flag naming a JSON file whose object maps flag names
+to values, for instance {"listen": ":4242", "echo": true}. A flag given on the command
+line overrides the environment, which overrides the config file.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	run     func(args []string) error
+	summary string
+}
+
+var commands = map[string]command{
+	"bench":     {bench, "measure the throughput and latency of a server"},
+	"dissector": {dissector, "generate a Wireshark dissector"},
+	"inspect":   {inspect, "describe and optionally decrypt a packet"},
+	"keygen":    {keygen, "generate a key pair"},
+	"seal":      {seal, "encrypt data to a server public key"},
+	"open":      {open, "decrypt a packet with a server private key"},
+	"serve":     {serve, "run a UDP server that logs or echoes requests"},
+	"request":   {request, "send a request to a UDP server and print the reply"},
+	"tunnel":    {tunnel, "forward a local UDP port through PSSST"},
+	"vectors":   {vectors, "generate test vectors for other implementations"},
+}
+
+// envName returns the environment variable that sets a flag of a command.
+func envName(command, flagName string) string {
+	return strings.ToUpper("PSSST_" + command + "_" + strings.Replace(flagName, "-", "_", -1))
+}
+
+/*
+parseFlags adds a -config flag, parses the command line and then sets any remaining flags
+from the environment and then from the config file.
+*/
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	configFile := flags.String("config", "", "JSON `file` of flag values, for flags not set on the command line or in the environment")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		name := envName(flags.Name(), f.Name)
+		if value, ok := os.LookupEnv(name); ok {
+			if setErr := flags.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %s", value, name, setErr)
+			}
+			set[f.Name] = true
+		}
+	})
+	if err != nil || *configFile == "" {
+		return err
+	}
+
+	return applyConfig(flags, *configFile, set)
+}
+
+// applyConfig sets the flags named in a JSON config file, other than those already set.
+func applyConfig(flags *flag.FlagSet, configFile string, set map[string]bool) error {
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+
+	var values map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("reading %s: %s", configFile, err)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if flags.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("unknown flag %q in %s", name, configFile)
+		}
+		if set[name] {
+			continue
+		}
+
+		var value string
+		switch v := values[name].(type) {
+		case string:
+			value = v
+		case bool, json.Number:
+			value = fmt.Sprint(v)
+		default:
+			return fmt.Errorf("value of %q in %s must be a string, number or boolean", name, configFile)
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for %q in %s: %s", value, name, configFile, err)
+		}
+	}
+
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: pssst <command> [arguments]\n\nCommands:\n")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun \"pssst <command> -h\" for help with a command.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "pssst: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "pssst %s: %s\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
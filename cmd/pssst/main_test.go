@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFlagsPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pssst")
+	if err != nil {
+		t.Fatalf("Creating temporary directory failed with %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.json")
+	config := `{"line": "config", "env": "config", "file": "config", "count": 7, "verbose": true}`
+	if err := ioutil.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatalf("Writing config failed with %s", err)
+	}
+
+	os.Setenv("PSSST_TEST_LINE", "env")
+	os.Setenv("PSSST_TEST_ENV", "env")
+	defer os.Unsetenv("PSSST_TEST_LINE")
+	defer os.Unsetenv("PSSST_TEST_ENV")
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	line := flags.String("line", "default", "")
+	env := flags.String("env", "default", "")
+	file := flags.String("file", "default", "")
+	unset := flags.String("unset", "default", "")
+	count := flags.Int("count", 0, "")
+	verbose := flags.Bool("verbose", false, "")
+
+	if err := parseFlags(flags, []string{"-line", "line", "-config", configFile}); err != nil {
+		t.Fatalf("Parsing flags failed with %s", err)
+	}
+
+	for _, check := range []struct{ name, got, want string }{
+		{"line", *line, "line"},
+		{"env", *env, "env"},
+		{"file", *file, "config"},
+		{"unset", *unset, "default"},
+	} {
+		if check.got != check.want {
+			t.Errorf("Flag -%s is %q, want %q", check.name, check.got, check.want)
+		}
+	}
+	if *count != 7 || !*verbose {
+		t.Errorf("Config values not applied: count %d, verbose %v", *count, *verbose)
+	}
+}
+
+func TestParseFlagsBadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pssst")
+	if err != nil {
+		t.Fatalf("Creating temporary directory failed with %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, config := range []string{
+		`{"missing": "x"}`,
+		`{"config": "other.json"}`,
+		`{"count": "many"}`,
+		`{"count": [1]}`,
+		`not json`,
+	} {
+		configFile := filepath.Join(dir, "config.json")
+		if err := ioutil.WriteFile(configFile, []byte(config), 0600); err != nil {
+			t.Fatalf("Writing config failed with %s", err)
+		}
+
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.Int("count", 0, "")
+		if err := parseFlags(flags, []string{"-config", configFile}); err == nil {
+			t.Errorf("Config %s was accepted", config)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nickovs/gopssst"
+)
+
+const (
+	stageCount     = int(gopssst.StageAEAD) + 1
+	operationCount = int(gopssst.OperationUnpackReply) + 1
+)
+
+type durationSummary struct {
+	count uint64
+	sum   time.Duration
+}
+
+/*
+serverMetrics collects the library's instrumentation for the serve command and writes it
+in the Prometheus text exposition format.
+*/
+type serverMetrics struct {
+	mutex      sync.Mutex
+	stages     [stageCount]durationSummary
+	operations [operationCount]durationSummary
+	errors     [operationCount]uint64
+}
+
+func (m *serverMetrics) ObserveStage(stage gopssst.Stage, duration time.Duration) {
+	m.mutex.Lock()
+	m.stages[stage].count++
+	m.stages[stage].sum += duration
+	m.mutex.Unlock()
+}
+
+func (m *serverMetrics) ObserveOperation(operation gopssst.Operation, duration time.Duration, err error) {
+	m.mutex.Lock()
+	m.operations[operation].count++
+	m.operations[operation].sum += duration
+	if err != nil {
+		m.errors[operation]++
+	}
+	m.mutex.Unlock()
+}
+
+func (m *serverMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var b bytes.Buffer
+
+	m.mutex.Lock()
+	b.WriteString("# HELP pssst_operation_duration_seconds Time taken by complete packet operations.\n")
+	b.WriteString("# TYPE pssst_operation_duration_seconds summary\n")
+	for i, s := range m.operations {
+		name := gopssst.Operation(i).String()
+		fmt.Fprintf(&b, "pssst_operation_duration_seconds_sum{operation=%q} %g\n", name, s.sum.Seconds())
+		fmt.Fprintf(&b, "pssst_operation_duration_seconds_count{operation=%q} %d\n", name, s.count)
+	}
+	b.WriteString("# HELP pssst_operation_errors_total Packet operations that failed.\n")
+	b.WriteString("# TYPE pssst_operation_errors_total counter\n")
+	for i, count := range m.errors {
+		fmt.Fprintf(&b, "pssst_operation_errors_total{operation=%q} %d\n", gopssst.Operation(i).String(), count)
+	}
+	b.WriteString("# HELP pssst_stage_duration_seconds Time taken by each stage of packet processing.\n")
+	b.WriteString("# TYPE pssst_stage_duration_seconds summary\n")
+	for i, s := range m.stages {
+		name := gopssst.Stage(i).String()
+		fmt.Fprintf(&b, "pssst_stage_duration_seconds_sum{stage=%q} %g\n", name, s.sum.Seconds())
+		fmt.Fprintf(&b, "pssst_stage_duration_seconds_count{stage=%q} %d\n", name, s.count)
+	}
+	m.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(b.Bytes())
+}
+
+// healthProbes records the local addresses of health checks waiting for a reply.
+type healthProbes struct {
+	mutex sync.Mutex
+	addrs map[string]bool
+}
+
+func (p *healthProbes) add(addr string) {
+	p.mutex.Lock()
+	if p.addrs == nil {
+		p.addrs = make(map[string]bool)
+	}
+	p.addrs[addr] = true
+	p.mutex.Unlock()
+}
+
+func (p *healthProbes) remove(addr string) {
+	p.mutex.Lock()
+	delete(p.addrs, addr)
+	p.mutex.Unlock()
+}
+
+func (p *healthProbes) has(addr string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.addrs[addr]
+}
+
+/*
+healthHandler reports whether the server is healthy. It sends a request packed to the
+current key to the server's own socket and waits for the reply, so the check fails if the
+receive loop has stopped or the key no longer works. The receive loop answers requests
+from a registered probe address with the state's probe server, so that health checks
+don't show up in the metrics.
+*/
+func healthHandler(current *atomic.Value, serverAddr net.Addr, probes *healthProbes, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := current.Load().(*serverState)
+		if err := selfTest(state, serverAddr, probes, timeout); err != nil {
+			http.Error(w, "self-test failed: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprintf(w, "ok\n")
+	})
+}
+
+func selfTest(state *serverState, serverAddr net.Addr, probes *healthProbes, timeout time.Duration) error {
+	udpAddr, ok := serverAddr.(*net.UDPAddr)
+	if !ok {
+		return fmt.Errorf("can't probe a %s socket", serverAddr.Network())
+	}
+	target := *udpAddr
+	if target.IP == nil || target.IP.IsUnspecified() {
+		if target.IP.To4() != nil {
+			target.IP = net.IPv4(127, 0, 0, 1)
+		} else {
+			target.IP = net.IPv6loopback
+		}
+	}
+
+	conn, err := net.DialUDP("udp", nil, &target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	probeAddr := conn.LocalAddr().String()
+	probes.add(probeAddr)
+	defer probes.remove(probeAddr)
+
+	client, err := gopssst.NewClient(gopssst.CipherSuiteX25519AESGCM, state.publicKey, nil)
+	if err != nil {
+		return err
+	}
+
+	probe := []byte("healthz")
+	reply, err := gopssst.Exchange(conn, client, probe, timeout, 1)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(reply, probe) {
+		return fmt.Errorf("wrong data in reply")
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nickovs/gopssst"
+)
+
+func TestHealthAndMetrics(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := gopssst.GenerateKeyPair(gopssst.CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+
+	metrics := &serverMetrics{}
+	server, err := gopssst.NewServer(gopssst.CipherSuiteX25519AESGCM, serverPrivateKey, gopssst.WithServerMetrics(metrics))
+	if err != nil {
+		t.Fatalf("Creating server failed with %s", err)
+	}
+	probe, err := gopssst.NewServer(gopssst.CipherSuiteX25519AESGCM, serverPrivateKey)
+	if err != nil {
+		t.Fatalf("Creating probe server failed with %s", err)
+	}
+
+	var current atomic.Value
+	current.Store(&serverState{server, probe, serverPublicKey.([]byte)})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed with %s", err)
+	}
+	probes := &healthProbes{}
+	done := make(chan error, 1)
+	go func() {
+		done <- handleRequests(conn, &current, probes, true)
+	}()
+	health := healthHandler(&current, conn.LocalAddr(), probes, 200*time.Millisecond)
+
+	recorder := httptest.NewRecorder()
+	health.ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Health check failed with status %d: %s", recorder.Code, recorder.Body)
+	}
+
+	recorder = httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(recorder.Body.String(), `pssst_operation_duration_seconds_count{operation="unpack"} 0`) {
+		t.Errorf("Metrics counted the health check unpack:\n%s", recorder.Body)
+	}
+
+	// The probe must be answered by the probe server, not the instrumented one
+	if !strings.Contains(recorder.Body.String(), `pssst_operation_duration_seconds_count{operation="reply"} 0`) {
+		t.Errorf("Metrics counted the health check reply:\n%s", recorder.Body)
+	}
+
+	// A server whose key does not match the public key must fail the self-test
+	otherPrivateKey, _, _ := gopssst.GenerateKeyPair(gopssst.CipherSuiteX25519AESGCM, nil)
+	otherServer, _ := gopssst.NewServer(gopssst.CipherSuiteX25519AESGCM, otherPrivateKey)
+	current.Store(&serverState{otherServer, otherServer, serverPublicKey.([]byte)})
+
+	recorder = httptest.NewRecorder()
+	health.ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Health check with a bad key gave status %d", recorder.Code)
+	}
+
+	// Once the receive loop has stopped the health check must fail even with a good key
+	current.Store(&serverState{server, probe, serverPublicKey.([]byte)})
+	conn.Close()
+	<-done
+
+	recorder = httptest.NewRecorder()
+	health.ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Health check with a closed socket gave status %d", recorder.Code)
+	}
+}
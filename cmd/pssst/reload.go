@@ -0,0 +1,12 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals are the signals that make the serve command reload its key.
+var reloadSignals = []os.Signal{syscall.SIGHUP}
@@ -0,0 +1,8 @@
+package main
+
+import (
+	"os"
+)
+
+// There are no signals under js/wasm, so the key is never reloaded.
+var reloadSignals []os.Signal
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/nickovs/gopssst"
+)
+
+func readInput(path string) ([]byte, error) {
+	if path == "" || path == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(path)
+}
+
+func writeOutput(path string, data []byte) error {
+	if path == "" || path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// newClient makes a client from key files or a client key store. If clientKeyFile is empty the client is anonymous.
+func newClient(serverKeyFile, clientKeyFile string) (gopssst.Client, error) {
+	serverPublicKey, err := readKey(serverKeyFile, false)
+	if err != nil {
+		return nil, err
+	}
+	return newClientFor(serverPublicKey, clientKeyFile)
+}
+
+// newClientFor makes a client for a server public key, with a client key file or key store as for newClient.
+func newClientFor(serverPublicKey []byte, clientKeyFile string) (gopssst.Client, error) {
+	if clientKeyFile == "" {
+		return gopssst.NewClient(gopssst.CipherSuiteX25519AESGCM, serverPublicKey, nil)
+	}
+
+	// A client key that isn't a file may be a key store written by keygen -store
+	if _, err := os.Stat(clientKeyFile); os.IsNotExist(err) {
+		identity, err := gopssst.NewKeyStore(clientKeyFile).Load()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", clientKeyFile, err)
+		}
+		return gopssst.NewClient(gopssst.CipherSuiteX25519AESGCM, serverPublicKey, identity)
+	}
+
+	clientPrivateKey, err := readKey(clientKeyFile, true)
+	if err != nil {
+		return nil, err
+	}
+	return gopssst.NewClient(gopssst.CipherSuiteX25519AESGCM, serverPublicKey, clientPrivateKey)
+}
+
+func seal(args []string) error {
+	flags := flag.NewFlagSet("seal", flag.ExitOnError)
+	serverKeyFile := flags.String("key", "", "server public key `file`")
+	clientKeyFile := flags.String("client-key", "", "client private key `file` or key store, to authenticate the client")
+	armor := flags.Bool("armor", false, "write the packet as ASCII armor instead of raw bytes")
+	in := flags.String("in", "-", "input `file`")
+	out := flags.String("out", "-", "output `file`")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pssst seal -key server.pub [-client-key file] [-armor] [-in file] [-out file]\n\n")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *serverKeyFile == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("a server public key is required")
+	}
+
+	client, err := newClient(*serverKeyFile, *clientKeyFile)
+	if err != nil {
+		return err
+	}
+
+	data, err := readInput(*in)
+	if err != nil {
+		return err
+	}
+
+	packetBytes, _, err := client.PackOutgoing(data)
+	if err != nil {
+		return err
+	}
+
+	if *armor {
+		if packetBytes, err = gopssst.Armor(packetBytes); err != nil {
+			return err
+		}
+	}
+
+	return writeOutput(*out, packetBytes)
+}
+
+func open(args []string) error {
+	flags := flag.NewFlagSet("open", flag.ExitOnError)
+	serverKeyFile := flags.String("key", "", "server private key `file`")
+	in := flags.String("in", "-", "input `file`, either a raw or an armored packet")
+	out := flags.String("out", "-", "output `file`")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pssst open -key server [-in file] [-out file]\n\n")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *serverKeyFile == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("a server private key is required")
+	}
+
+	serverPrivateKey, err := readKey(*serverKeyFile, true)
+	if err != nil {
+		return err
+	}
+
+	server, err := gopssst.NewServer(gopssst.CipherSuiteX25519AESGCM, serverPrivateKey)
+	if err != nil {
+		return err
+	}
+
+	packetBytes, err := readInput(*in)
+	if err != nil {
+		return err
+	}
+
+	if packetBytes, err = unarmorPacket(packetBytes); err != nil {
+		return err
+	}
+
+	data, _, clientPublicKey, err := server.UnpackIncoming(packetBytes)
+	if err != nil {
+		return err
+	}
+
+	if clientPublicKey != nil {
+		fmt.Fprintf(os.Stderr, "Client: %s\n", fingerprint(clientPublicKey.([]byte)))
+	}
+
+	return writeOutput(*out, data)
+}
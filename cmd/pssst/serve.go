@@ -0,0 +1,228 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"time"
+
+	"github.com/nickovs/gopssst"
+)
+
+const maxDatagramSize = 65536
+
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	serverKeyFile := flags.String("key", "", "server private key `file`")
+	listen := flags.String("listen", ":4242", "UDP `address` to listen on")
+	echo := flags.Bool("echo", false, "reply with the request data instead of an empty reply")
+	metricsAddress := flags.String("metrics-addr", "", "serve /metrics and /healthz over HTTP on `address`")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pssst serve -key server [-listen address] [-echo] [-metrics-addr address]\n\n")
+		fmt.Fprintf(flags.Output(), "Requests are logged to stderr and, unless -echo is set, their data is written to stdout.\n")
+		fmt.Fprintf(flags.Output(), "A socket passed by systemd socket activation is used instead of -listen. The key is reloaded on SIGHUP.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *serverKeyFile == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("a server private key is required")
+	}
+
+	var options []gopssst.ServerOption
+	var metrics *serverMetrics
+	if *metricsAddress != "" {
+		metrics = &serverMetrics{}
+		options = append(options, gopssst.WithServerMetrics(metrics))
+	}
+
+	var current atomic.Value
+	state, err := loadServer(*serverKeyFile, options...)
+	if err != nil {
+		return err
+	}
+	current.Store(state)
+
+	// On SIGHUP the key is reloaded; requests already being handled finish with the old key
+	reload := make(chan os.Signal, 1)
+	if reloadSignals != nil {
+		signal.Notify(reload, reloadSignals...)
+	}
+	go func() {
+		for range reload {
+			state, err := loadServer(*serverKeyFile, options...)
+			if err != nil {
+				log.Printf("Reloading key failed, keeping the old key: %s", err)
+				continue
+			}
+			current.Store(state)
+			log.Printf("Reloaded key from %s", *serverKeyFile)
+		}
+	}()
+
+	conn, err := listenPacket(*listen)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	log.Printf("Listening on %s", conn.LocalAddr())
+
+	probes := &healthProbes{}
+	if metrics != nil {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		mux.Handle("/healthz", healthHandler(&current, conn.LocalAddr(), probes, time.Second))
+		go func() {
+			log.Printf("Serving metrics on %s", *metricsAddress)
+			log.Printf("Metrics server failed: %s", http.ListenAndServe(*metricsAddress, mux))
+		}()
+	}
+
+	return handleRequests(conn, &current, probes, *echo)
+}
+
+/*
+handleRequests answers requests on conn with the current server state until reading from
+conn fails. Requests from health check probes are echoed using the probe server.
+*/
+func handleRequests(conn net.PacketConn, current *atomic.Value, probes *healthProbes, echo bool) error {
+	cache := gopssst.NewReplyCache(time.Minute, 1024)
+	buf := make([]byte, maxDatagramSize)
+
+	for {
+		n, addr, err := readDatagram(conn, buf)
+		if err != nil {
+			return err
+		}
+
+		reply, err := cache.Handle(buf[:n], func(requestPacket []byte) ([]byte, error) {
+			state := current.Load().(*serverState)
+			if probes.has(addr.String()) {
+				data, replyHandler, _, err := state.probe.UnpackIncoming(requestPacket)
+				if err != nil {
+					return nil, err
+				}
+				return replyHandler(data)
+			}
+
+			data, replyHandler, clientPublicKey, err := state.server.UnpackIncoming(requestPacket)
+			if err != nil {
+				return nil, err
+			}
+
+			client := "anonymous client"
+			if clientPublicKey != nil {
+				client = fingerprint(clientPublicKey.([]byte))
+			}
+			log.Printf("%d bytes from %s (%s)", len(data), addr, client)
+
+			if echo {
+				return replyHandler(data)
+			}
+			os.Stdout.Write(data)
+			return replyHandler(nil)
+		})
+		if err != nil {
+			log.Printf("Bad packet from %s: %s", addr, err)
+			continue
+		}
+		if reply == nil {
+			continue
+		}
+
+		if _, err = conn.WriteTo(reply, addr); err != nil {
+			log.Printf("Sending reply to %s failed: %s", addr, err)
+		}
+	}
+}
+
+/*
+serverState is the server for the current key, replaced as a whole when the key is
+reloaded. probe is a second server for the same key without metrics, for health checks
+that should not be counted as traffic.
+*/
+type serverState struct {
+	server    gopssst.Server
+	probe     gopssst.Server
+	publicKey []byte
+}
+
+func loadServer(serverKeyFile string, options ...gopssst.ServerOption) (*serverState, error) {
+	serverPrivateKey, err := readKey(serverKeyFile, true)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := gopssst.NewServer(gopssst.CipherSuiteX25519AESGCM, serverPrivateKey, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	probe, err := gopssst.NewServer(gopssst.CipherSuiteX25519AESGCM, serverPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	serverPublicKey, err := server.GetServerPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return &serverState{server, probe, serverPublicKey.([]byte)}, nil
+}
+
+func request(args []string) error {
+	flags := flag.NewFlagSet("request", flag.ExitOnError)
+	serverKeyFile := flags.String("key", "", "server public key `file`")
+	clientKeyFile := flags.String("client-key", "", "client private key `file` or key store, to authenticate the client")
+	address := flags.String("server", "localhost:4242", "server UDP `address`")
+	timeout := flags.Duration("timeout", 2*time.Second, "time to wait for a reply before retransmitting")
+	attempts := flags.Int("attempts", 3, "number of times to send the request")
+	in := flags.String("in", "-", "input `file`")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pssst request -key server.pub [-client-key file] [-server address] [-in file]\n\n")
+		fmt.Fprintf(flags.Output(), "The reply data is written to stdout.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *serverKeyFile == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("a server public key is required")
+	}
+
+	client, err := newClient(*serverKeyFile, *clientKeyFile)
+	if err != nil {
+		return err
+	}
+
+	data, err := readInput(*in)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.Dial("udp", *address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	reply, err := gopssst.Exchange(conn, client, data, *timeout, *attempts)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(reply)
+	return err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// systemdListenFDsStart is the first file descriptor passed by systemd socket activation.
+const systemdListenFDsStart = 3
+
+/*
+systemdPacketConn returns the socket passed by systemd socket activation, or nil if the
+process was not started that way. Only a single datagram socket is supported.
+*/
+func systemdPacketConn() (net.PacketConn, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+	if count > 1 {
+		return nil, fmt.Errorf("systemd passed %d sockets, expected 1", count)
+	}
+
+	// The variables must not leak to child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	file := os.NewFile(systemdListenFDsStart, "systemd socket")
+	defer file.Close()
+
+	return net.FilePacketConn(file)
+}
+
+// listenPacket listens on address, unless a socket was passed by systemd.
+func listenPacket(address string) (net.PacketConn, error) {
+	conn, err := systemdPacketConn()
+	if conn != nil || err != nil {
+		return conn, err
+	}
+	return net.ListenPacket("udp", address)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/nickovs/gopssst"
+)
+
+/*
+A tunnel has two ends. The entry end listens for plain UDP datagrams and sends each one
+as a PSSST request to the exit end, which forwards the data to the target service and
+returns the target's response as the reply. Each datagram therefore gets at most one
+datagram in response, which suits request/response protocols such as DNS or NTP.
+*/
+
+func tunnel(args []string) error {
+	flags := flag.NewFlagSet("tunnel", flag.ExitOnError)
+	exit := flags.Bool("exit", false, "run the exit end of the tunnel, which needs the server private key")
+	keyFile := flags.String("key", "", "server public key `file`, or private key file with -exit")
+	clientKeyFile := flags.String("client-key", "", "client private key `file` or key store, to authenticate the entry end")
+	listen := flags.String("listen", "", "UDP `address` to listen on")
+	forward := flags.String("forward", "", "UDP `address` of the exit end, or of the target service with -exit")
+	timeout := flags.Duration("timeout", 2*time.Second, "time to wait for each response")
+	attempts := flags.Int("attempts", 3, "number of times the entry end sends each request")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pssst tunnel -key server.pub [-client-key file] -listen address -forward exit-address\n")
+		fmt.Fprintf(flags.Output(), "       pssst tunnel -exit -key server -listen address -forward target-address\n\n")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *keyFile == "" || *listen == "" || *forward == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("a key, listen address and forward address are required")
+	}
+
+	conn, err := net.ListenPacket("udp", *listen)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if *exit {
+		serverPrivateKey, err := readKey(*keyFile, true)
+		if err != nil {
+			return err
+		}
+		server, err := gopssst.NewServer(gopssst.CipherSuiteX25519AESGCM, serverPrivateKey)
+		if err != nil {
+			return err
+		}
+		log.Printf("Tunnel exit listening on %s, forwarding to %s", conn.LocalAddr(), *forward)
+		return tunnelExit(conn, server, *forward, *timeout)
+	}
+
+	client, err := newClient(*keyFile, *clientKeyFile)
+	if err != nil {
+		return err
+	}
+	log.Printf("Tunnel entry listening on %s, forwarding to %s", conn.LocalAddr(), *forward)
+	return tunnelEntry(conn, client, *forward, *timeout, *attempts)
+}
+
+func tunnelEntry(conn net.PacketConn, client gopssst.Client, exitAddress string, timeout time.Duration, attempts int) error {
+	for {
+		buf := make([]byte, maxDatagramSize)
+		n, addr, err := readDatagram(conn, buf)
+		if err != nil {
+			return err
+		}
+
+		go func(data []byte, addr net.Addr) {
+			exitConn, err := net.Dial("udp", exitAddress)
+			if err != nil {
+				log.Printf("Connecting to %s failed: %s", exitAddress, err)
+				return
+			}
+			defer exitConn.Close()
+
+			reply, err := gopssst.Exchange(exitConn, client, data, timeout, attempts)
+			if err != nil {
+				log.Printf("Request from %s failed: %s", addr, err)
+				return
+			}
+			if len(reply) == 0 {
+				return
+			}
+			if _, err = conn.WriteTo(reply, addr); err != nil {
+				log.Printf("Sending response to %s failed: %s", addr, err)
+			}
+		}(buf[:n], addr)
+	}
+}
+
+func tunnelExit(conn net.PacketConn, server gopssst.Server, targetAddress string, timeout time.Duration) error {
+	// Retransmissions must not be forwarded again, so the cache has to outlive the entry end's retries
+	cache := gopssst.NewReplyCache(time.Minute, 4096)
+
+	for {
+		buf := make([]byte, maxDatagramSize)
+		n, addr, err := readDatagram(conn, buf)
+		if err != nil {
+			return err
+		}
+
+		go func(packetBytes []byte, addr net.Addr) {
+			reply, err := cache.Handle(packetBytes, func(requestPacket []byte) ([]byte, error) {
+				data, replyHandler, _, err := server.UnpackIncoming(requestPacket)
+				if err != nil {
+					return nil, err
+				}
+				return replyHandler(forwardDatagram(targetAddress, data, timeout))
+			})
+			if err != nil {
+				log.Printf("Bad packet from %s: %s", addr, err)
+				return
+			}
+			if reply == nil {
+				return
+			}
+			if _, err = conn.WriteTo(reply, addr); err != nil {
+				log.Printf("Sending reply to %s failed: %s", addr, err)
+			}
+		}(buf[:n], addr)
+	}
+}
+
+// forwardDatagram sends data to the target and returns its response, or nil if there is none.
+func forwardDatagram(targetAddress string, data []byte, timeout time.Duration) []byte {
+	targetConn, err := net.Dial("udp", targetAddress)
+	if err != nil {
+		log.Printf("Connecting to %s failed: %s", targetAddress, err)
+		return nil
+	}
+	defer targetConn.Close()
+
+	if _, err = targetConn.Write(data); err != nil {
+		log.Printf("Forwarding to %s failed: %s", targetAddress, err)
+		return nil
+	}
+	if err = targetConn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil
+	}
+
+	buf := make([]byte, maxDatagramSize)
+	n, err := targetConn.Read(buf)
+	if err != nil {
+		return nil
+	}
+	return buf[:n]
+}
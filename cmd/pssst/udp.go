@@ -0,0 +1,18 @@
+package main
+
+import (
+	"net"
+)
+
+/*
+readDatagram reads the next datagram from conn, skipping errors that only report the
+fate of an earlier send, so that a server loop does not stop because one peer has gone.
+*/
+func readDatagram(conn net.PacketConn, buf []byte) (n int, addr net.Addr, err error) {
+	for {
+		n, addr, err = conn.ReadFrom(buf)
+		if err == nil || !isSendFailureError(err) {
+			return
+		}
+	}
+}
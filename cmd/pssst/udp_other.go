@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+// isSendFailureError reports whether err only reports the failure of an earlier send. Other
+// systems do not report those on unconnected sockets.
+func isSendFailureError(err error) bool {
+	return false
+}
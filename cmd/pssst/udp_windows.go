@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// wsaENETRESET is not defined by package syscall
+const wsaENETRESET syscall.Errno = 10052
+
+/*
+isSendFailureError reports whether err is Windows reporting that an earlier datagram
+could not be delivered. When an ICMP port unreachable comes back for a datagram sent
+from a UDP socket, even an unconnected one, the next receive on the socket fails with
+WSAECONNRESET; WSAENETRESET is the equivalent for ICMP TTL expired. Neither means the
+socket itself has failed.
+*/
+func isSendFailureError(err error) bool {
+	var errno syscall.Errno
+	return errors.As(err, &errno) && (errno == syscall.WSAECONNRESET || errno == wsaENETRESET)
+}
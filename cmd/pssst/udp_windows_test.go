@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestIsSendFailureError(t *testing.T) {
+	reset := &net.OpError{Op: "read", Net: "udp", Err: fmt.Errorf("wsarecvfrom: %w", syscall.WSAECONNRESET)}
+	if !isSendFailureError(reset) {
+		t.Errorf("WSAECONNRESET not recognised")
+	}
+	if isSendFailureError(&net.OpError{Op: "read", Net: "udp", Err: syscall.WSAEACCES}) {
+		t.Errorf("WSAEACCES treated as a send failure")
+	}
+}
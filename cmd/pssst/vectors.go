@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"golang.org/x/crypto/curve25519"
+
+	"github.com/nickovs/gopssst"
+)
+
+// hexBytes is written to JSON as a hex string rather than base64.
+type hexBytes []byte
+
+func (b hexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(b))
+}
+
+type testVector struct {
+	Description      string   `json:"description"`
+	ServerPrivateKey hexBytes `json:"server_private_key"`
+	ServerPublicKey  hexBytes `json:"server_public_key"`
+	ClientPrivateKey hexBytes `json:"client_private_key,omitempty"`
+	ClientPublicKey  hexBytes `json:"client_public_key,omitempty"`
+	SessionSecret    hexBytes `json:"session_secret"`
+	DHParam          hexBytes `json:"dh_param"`
+	SharedSecret     hexBytes `json:"shared_secret"`
+	Key              hexBytes `json:"key"`
+	RequestNonce     hexBytes `json:"request_nonce"`
+	ReplyNonce       hexBytes `json:"reply_nonce"`
+	RequestData      hexBytes `json:"request_data"`
+	RequestPacket    hexBytes `json:"request_packet"`
+	ReplyData        hexBytes `json:"reply_data"`
+	ReplyPacket      hexBytes `json:"reply_packet"`
+}
+
+type testVectors struct {
+	CipherSuite int          `json:"cipher_suite"`
+	Seed        string       `json:"seed"`
+	Vectors     []testVector `json:"vectors"`
+}
+
+/*
+seededRandom is a deterministic byte stream, SHA-256 of the seed and a block counter,
+so that the same seed always gives the same vectors. It is not safe for concurrent use.
+*/
+type seededRandom struct {
+	seed    []byte
+	counter uint64
+	buffer  []byte
+	// recorded accumulates everything read, so the session secret can be recovered
+	recorded []byte
+}
+
+func (r *seededRandom) Read(p []byte) (int, error) {
+	for n := 0; n < len(p); {
+		if len(r.buffer) == 0 {
+			var counter [8]byte
+			binary.BigEndian.PutUint64(counter[:], r.counter)
+			r.counter++
+			block := sha256.Sum256(append(append([]byte{}, r.seed...), counter[:]...))
+			r.buffer = block[:]
+		}
+		copied := copy(p[n:], r.buffer)
+		r.buffer = r.buffer[copied:]
+		n += copied
+	}
+	r.recorded = append(r.recorded, p...)
+	return len(p), nil
+}
+
+func (r *seededRandom) bytes(n int) []byte {
+	b := make([]byte, n)
+	r.Read(b)
+	return b
+}
+
+func vectors(args []string) error {
+	flags := flag.NewFlagSet("vectors", flag.ExitOnError)
+	suite := flags.Int("suite", gopssst.CipherSuiteX25519AESGCM, "cipher `suite`")
+	seed := flags.String("seed", "pssst", "`seed` from which all keys and data are derived")
+	out := flags.String("out", "-", "output `file`")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pssst vectors [-suite n] [-seed string] [-out file]\n\n")
+		fmt.Fprintf(flags.Output(), "Writes JSON test vectors, with every intermediate value, for other implementations.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments")
+	}
+	if *suite != gopssst.CipherSuiteX25519AESGCM {
+		return fmt.Errorf("unsupported cipher suite %d", *suite)
+	}
+
+	random := &seededRandom{seed: []byte(*seed)}
+	result := testVectors{CipherSuite: *suite, Seed: *seed}
+
+	for _, clientAuth := range []bool{false, true} {
+		for _, size := range []int{0, 16, 100} {
+			vector, err := makeTestVector(random, clientAuth, size)
+			if err != nil {
+				return err
+			}
+			result.Vectors = append(result.Vectors, vector)
+		}
+	}
+
+	encoded, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(*out, append(encoded, '\n'))
+}
+
+/*
+makeTestVector runs one exchange with keys and data from random. The intermediate values
+are computed independently of the library and checked against the packets it produced,
+so a vector is never written unless both agree.
+*/
+func makeTestVector(random *seededRandom, clientAuth bool, size int) (v testVector, err error) {
+	serverPrivateKey, serverPublicKey, err := gopssst.GenerateKeyPair(gopssst.CipherSuiteX25519AESGCM, random)
+	if err != nil {
+		return
+	}
+	v.ServerPrivateKey = serverPrivateKey.([]byte)
+	v.ServerPublicKey = serverPublicKey.([]byte)
+
+	server, err := gopssst.NewServer(gopssst.CipherSuiteX25519AESGCM, serverPrivateKey)
+	if err != nil {
+		return
+	}
+
+	var client gopssst.Client
+	if clientAuth {
+		v.Description = fmt.Sprintf("Client auth, %d bytes of data", size)
+		var clientPrivateKey, clientPublicKey interface{}
+		if clientPrivateKey, clientPublicKey, err = gopssst.GenerateKeyPair(gopssst.CipherSuiteX25519AESGCM, random); err != nil {
+			return
+		}
+		v.ClientPrivateKey = clientPrivateKey.([]byte)
+		v.ClientPublicKey = clientPublicKey.([]byte)
+		client, err = gopssst.NewClient(gopssst.CipherSuiteX25519AESGCM, serverPublicKey, clientPrivateKey, gopssst.WithClientRandom(random))
+	} else {
+		v.Description = fmt.Sprintf("Anonymous client, %d bytes of data", size)
+		client, err = gopssst.NewClient(gopssst.CipherSuiteX25519AESGCM, serverPublicKey, nil, gopssst.WithClientRandom(random))
+	}
+	if err != nil {
+		return
+	}
+
+	v.RequestData = random.bytes(size)
+	v.ReplyData = random.bytes(size)
+
+	random.recorded = nil
+	requestPacket, replyHandler, err := client.PackOutgoing(v.RequestData)
+	if err != nil {
+		return
+	}
+	v.RequestPacket = requestPacket
+
+	// The session secret is the bytes the client read, clamped as described in RFC 7748
+	if len(random.recorded) != 32 {
+		err = fmt.Errorf("client read %d random bytes, expected 32", len(random.recorded))
+		return
+	}
+	v.SessionSecret = append([]byte{}, random.recorded...)
+	v.SessionSecret[0] &= 248
+	v.SessionSecret[31] &= 127
+	v.SessionSecret[31] |= 64
+
+	base, peer := curve25519.Basepoint, v.ServerPublicKey
+	if clientAuth {
+		base = v.ClientPublicKey
+		if peer, err = curve25519.X25519(v.ClientPrivateKey, v.ServerPublicKey); err != nil {
+			return
+		}
+	}
+	if v.DHParam, err = curve25519.X25519(v.SessionSecret, base); err != nil {
+		return
+	}
+	if v.SharedSecret, err = curve25519.X25519(v.SessionSecret, peer); err != nil {
+		return
+	}
+
+	derived := sha256.Sum256(append(append([]byte{}, v.DHParam...), v.SharedSecret...))
+	v.Key = derived[:16]
+	v.RequestNonce = append(append([]byte{}, derived[16:24]...), "RQST"...)
+	v.ReplyNonce = append(append([]byte{}, derived[24:32]...), "RPLY"...)
+
+	if err = checkTestVector(&v); err != nil {
+		return
+	}
+
+	serverData, serverReplyHandler, _, err := server.UnpackIncoming(requestPacket)
+	if err != nil {
+		return
+	}
+	if !bytes.Equal(serverData, v.RequestData) {
+		err = fmt.Errorf("server unpacked the wrong request data")
+		return
+	}
+	if v.ReplyPacket, err = serverReplyHandler(v.ReplyData); err != nil {
+		return
+	}
+
+	replyData, err := replyHandler(v.ReplyPacket)
+	if err != nil {
+		return
+	}
+	if !bytes.Equal(replyData, v.ReplyData) {
+		err = fmt.Errorf("client unpacked the wrong reply data")
+	}
+
+	return
+}
+
+// checkTestVector decrypts the request packet with the independently derived values.
+func checkTestVector(v *testVector) error {
+	if !bytes.Equal(v.RequestPacket[4:36], v.DHParam) {
+		return fmt.Errorf("derived DH param does not match the packet")
+	}
+
+	block, err := aes.NewCipher(v.Key)
+	if err != nil {
+		return err
+	}
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := aesgcm.Open(nil, v.RequestNonce, v.RequestPacket[36:], v.RequestPacket[:4])
+	if err != nil {
+		return fmt.Errorf("derived key does not decrypt the packet")
+	}
+
+	if v.ClientPublicKey != nil {
+		if len(plaintext) < 64 || !bytes.Equal(plaintext[:32], v.ClientPublicKey) || !bytes.Equal(plaintext[32:64], v.SessionSecret) {
+			return fmt.Errorf("request plaintext does not hold the client key and session secret")
+		}
+		plaintext = plaintext[64:]
+	}
+	if !bytes.Equal(plaintext, v.RequestData) {
+		return fmt.Errorf("request plaintext does not match the data")
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTestVectorsDeterministic(t *testing.T) {
+	for _, clientAuth := range []bool{false, true} {
+		a, err := makeTestVector(&seededRandom{seed: []byte("test")}, clientAuth, 20)
+		if err != nil {
+			t.Fatalf("Making vector failed with %s", err)
+		}
+		b, err := makeTestVector(&seededRandom{seed: []byte("test")}, clientAuth, 20)
+		if err != nil {
+			t.Fatalf("Making vector failed with %s", err)
+		}
+
+		if !bytes.Equal(a.RequestPacket, b.RequestPacket) || !bytes.Equal(a.ReplyPacket, b.ReplyPacket) {
+			t.Errorf("Vectors from the same seed differ (client auth %v)", clientAuth)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package gopssst
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+)
+
+/*
+Compress deflates request or reply data before it is packed, for payloads such as JSON
+telemetry that compress well. The packet header carries no compression flag, so
+compression is part of the application's data: both ends must agree to use it, and the
+receiver reverses it with Decompress.
+
+Compression leaks information through the packet length: if a message mixes secret data
+with data an attacker can influence, the attacker can learn the secret by watching how
+well messages compress, as in the CRIME and BREACH attacks. Only use it for payloads
+where that can't happen, such as telemetry from the device itself.
+*/
+func Compress(data []byte) []byte {
+	// Compression into a bytes.Buffer can't fail
+	var b bytes.Buffer
+	w, _ := flate.NewWriter(&b, flate.DefaultCompression)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+// Decompress inflates data from Compress, failing if the result would be longer than limit.
+func Decompress(data []byte, limit int) (result []byte, err error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	if result, err = ioutil.ReadAll(io.LimitReader(r, int64(limit)+1)); err != nil {
+		err = &PSSSTError{"Invalid compressed data"}
+		return
+	}
+	if len(result) > limit {
+		result, err = nil, &PSSSTError{"Decompressed data too long"}
+	}
+
+	return
+}
@@ -0,0 +1,56 @@
+package gopssst
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundtripCompression(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+	server, err := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	if err != nil {
+		t.Fatalf("Creating server failed with %s", err)
+	}
+	client, err := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+	if err != nil {
+		t.Fatalf("Creating client failed with %s", err)
+	}
+
+	telemetry := bytes.Repeat([]byte(`{"sensor":"temperature","value":21.5},`), 50)
+
+	request, _, err := client.PackOutgoing(Compress(telemetry))
+	if err != nil {
+		t.Fatalf("Packing request failed with %s", err)
+	}
+	if len(request) > len(telemetry)/4 {
+		t.Errorf("Request of %d bytes was only compressed to a %d byte packet", len(telemetry), len(request))
+	}
+
+	data, _, _, err := server.UnpackIncoming(request)
+	if err != nil {
+		t.Fatalf("Unpacking request failed with %s", err)
+	}
+	if data, err = Decompress(data, 4096); err != nil {
+		t.Fatalf("Decompressing request failed with %s", err)
+	}
+	if !bytes.Equal(data, telemetry) {
+		t.Errorf("Request data did not match after compression")
+	}
+}
+
+func TestDecompressLimits(t *testing.T) {
+	bomb := Compress(make([]byte, 1<<20))
+
+	if _, err := Decompress(bomb, 1<<20-1); err == nil {
+		t.Errorf("Data decompressing past the limit accepted")
+	}
+	if data, err := Decompress(bomb, 1<<20); err != nil || len(data) != 1<<20 {
+		t.Errorf("Data decompressing to the limit rejected")
+	}
+	if _, err := Decompress([]byte("not deflate"), 100); err == nil {
+		t.Errorf("Invalid compressed data accepted")
+	}
+}
@@ -0,0 +1,139 @@
+package gopssst
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// PacketHeader holds the cleartext fields at the start of a packet.
+type PacketHeader struct {
+	Flags       uint16
+	CipherSuite uint16
+	DHParam     []byte
+}
+
+// IsReply reports whether the packet is a reply.
+func (h PacketHeader) IsReply() bool {
+	return h.Flags&flagsReply != 0
+}
+
+// HasClientAuth reports whether the packet belongs to an exchange using client auth.
+func (h PacketHeader) HasClientAuth() bool {
+	return h.Flags&flagsClientAuth != 0
+}
+
+/*
+PeekHeader returns the cleartext header fields of a packet without decrypting it. The
+fields are unauthenticated until the packet has been unpacked.
+*/
+func PeekHeader(packetBytes []byte) (h PacketHeader, err error) {
+	var packetHeader header
+	if packetHeader, err = decodeHeader(packetBytes); err != nil {
+		return
+	}
+	if len(packetBytes) < 36 {
+		err = &PSSSTError{"Packet too short"}
+		return
+	}
+
+	h.Flags = packetHeader.Flags
+	h.CipherSuite = packetHeader.CipherSuite
+	h.DHParam = packetBytes[4:36]
+
+	return
+}
+
+func cipherSuiteName(cipherSuite uint16) string {
+	switch cipherSuite {
+	case CipherSuiteX25519AESGCM:
+		return "X25519-AESGCM128"
+	}
+	return "unknown"
+}
+
+func flagNames(flags uint16) string {
+	var names []string
+	if flags&flagsReply != 0 {
+		names = append(names, "reply")
+	}
+	if flags&flagsClientAuth != 0 {
+		names = append(names, "client-auth")
+	}
+	if unknown := flags &^ (flagsReply | flagsClientAuth); unknown != 0 {
+		names = append(names, fmt.Sprintf("unknown 0x%04x", unknown))
+	}
+	if names == nil {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+/*
+Dump returns a human readable description of a packet, annotating the header fields,
+flags, DH param and ciphertext length, followed by a hex dump of the whole packet. It is
+intended for troubleshooting from logs and packet captures.
+*/
+func Dump(packetBytes []byte) string {
+	var b strings.Builder
+
+	h, err := PeekHeader(packetBytes)
+	if err != nil {
+		fmt.Fprintf(&b, "Malformed PSSST packet, %d bytes: %s\n", len(packetBytes), err)
+		b.WriteString(hex.Dump(packetBytes))
+		return b.String()
+	}
+
+	kind := "request"
+	if h.IsReply() {
+		kind = "reply"
+	}
+
+	fmt.Fprintf(&b, "PSSST %s, %d bytes\n", kind, len(packetBytes))
+	fmt.Fprintf(&b, "  flags:       0x%04x (%s)\n", h.Flags, flagNames(h.Flags))
+	fmt.Fprintf(&b, "  suite:       %d (%s)\n", h.CipherSuite, cipherSuiteName(h.CipherSuite))
+	fmt.Fprintf(&b, "  dh param:    %x\n", h.DHParam)
+
+	ciphertextLength := len(packetBytes) - 36
+	fmt.Fprintf(&b, "  ciphertext:  %d bytes", ciphertextLength)
+	if h.CipherSuite == CipherSuiteX25519AESGCM {
+		plaintextLength := ciphertextLength - 16
+		if h.HasClientAuth() && !h.IsReply() {
+			plaintextLength -= 64
+		}
+		if plaintextLength >= 0 {
+			fmt.Fprintf(&b, " (%d bytes of data)", plaintextLength)
+		} else {
+			b.WriteString(" (truncated)")
+		}
+	}
+	b.WriteString("\n")
+
+	b.WriteString(hex.Dump(packetBytes))
+
+	return b.String()
+}
+
+/*
+DumpDecrypted returns the output of Dump for a request packet followed by its decrypted
+contents, using server to unpack it. Since the reply handler is discarded, only
+requests can be decrypted this way.
+*/
+func DumpDecrypted(packetBytes []byte, server Server) string {
+	var b strings.Builder
+	b.WriteString(Dump(packetBytes))
+
+	data, _, clientPublicKey, err := server.UnpackIncoming(packetBytes)
+	if err != nil {
+		fmt.Fprintf(&b, "Decryption failed: %s\n", err)
+		return b.String()
+	}
+
+	if clientPublicKey != nil {
+		fmt.Fprintf(&b, "  client key:  %x\n", clientPublicKey)
+	}
+	fmt.Fprintf(&b, "  data:        %d bytes\n", len(data))
+	b.WriteString(hex.Dump(data))
+
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package gopssst
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+
+	clientPrivateKey, _, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate client key failed with %s", err)
+	}
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, clientPrivateKey)
+
+	testMessage := []byte("This is a test!")
+
+	outgoingPacket, _, err := client.PackOutgoing(testMessage)
+	if err != nil {
+		t.Fatalf("Packing request packet failed with %s", err)
+	}
+
+	h, err := PeekHeader(outgoingPacket)
+	if err != nil {
+		t.Fatalf("Peeking header failed with %s", err)
+	}
+	if h.IsReply() || !h.HasClientAuth() || h.CipherSuite != CipherSuiteX25519AESGCM {
+		t.Errorf("Unexpected header %+v", h)
+	}
+	if !bytes.Equal(h.DHParam, outgoingPacket[4:36]) {
+		t.Errorf("Header DH param did not match")
+	}
+
+	dump := Dump(outgoingPacket)
+	for _, expected := range []string{"PSSST request", "client-auth", "X25519-AESGCM128", "(15 bytes of data)"} {
+		if !strings.Contains(dump, expected) {
+			t.Errorf("Dump did not contain %q:\n%s", expected, dump)
+		}
+	}
+
+	decrypted := DumpDecrypted(outgoingPacket, server)
+	if !strings.Contains(decrypted, "client key:") || !strings.Contains(decrypted, "|This is a test!|") {
+		t.Errorf("Decrypted dump did not show the request:\n%s", decrypted)
+	}
+
+	if !strings.Contains(Dump(outgoingPacket[:10]), "Malformed") {
+		t.Errorf("Truncated packet not reported as malformed")
+	}
+}
@@ -0,0 +1,68 @@
+package gopssst
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+/*
+ephemeralPool holds ephemeral keys generated in the background. A refill goroutine is
+only running while the pool is being topped up, so an idle pool holds no goroutines.
+*/
+type ephemeralPool struct {
+	base, peer []byte
+	random     io.Reader
+	keys       chan ephemeralKey
+	refilling  int32
+}
+
+func newEphemeralPool(size int, base, peer []byte, random io.Reader) *ephemeralPool {
+	pool := &ephemeralPool{
+		base:   base,
+		peer:   peer,
+		random: random,
+		keys:   make(chan ephemeralKey, size),
+	}
+	pool.refill()
+
+	return pool
+}
+
+func (pool *ephemeralPool) refill() {
+	if !atomic.CompareAndSwapInt32(&pool.refilling, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&pool.refilling, 0)
+
+		for len(pool.keys) < cap(pool.keys) {
+			key, err := newEphemeralKey(pool.base, pool.peer, pool.random, &stageTimer{})
+			if err != nil {
+				return
+			}
+			select {
+			case pool.keys <- key:
+			default:
+				return
+			}
+		}
+	}()
+}
+
+/*
+get returns a pre-generated key, or generates one inline if the pool is empty. Only
+keys generated inline are reported to timer; background generation is not timed.
+*/
+func (pool *ephemeralPool) get(timer *stageTimer) (ephemeralKey, error) {
+	select {
+	case key := <-pool.keys:
+		if len(pool.keys) < cap(pool.keys)/2 {
+			pool.refill()
+		}
+		return key, nil
+	default:
+		pool.refill()
+		return newEphemeralKey(pool.base, pool.peer, pool.random, timer)
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Package flat is a handle based API over gopssst for foreign function interfaces and
+embedding. Clients, servers and pending requests and replies are referred to by integer
+handles instead of interfaces and ReplyHandler closures, and every function takes and
+returns only handles, byte slices and errors, so each maps directly onto a C style call.
+Keys are the raw 32 byte X25519 keys used throughout gopssst.
+
+Handles are never reused within a process. A request handle is released when
+UnpackReply succeeds and a reply handle when Reply succeeds; other handles, and those
+left after a failure, must be released with Free.
+*/
+package flat
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/nickovs/gopssst"
+)
+
+// Handle refers to a client, server, pending request or pending reply. Zero is never a valid handle.
+type Handle uint64
+
+// ErrBadHandle is returned when a handle is unknown, already released or of the wrong kind.
+var ErrBadHandle = errors.New("PSSST Error: bad handle")
+
+// The two kinds of reply handler are given distinct types so one can't be passed as the other.
+type clientReply gopssst.ReplyHandler
+type serverReply gopssst.ReplyHandler
+
+var handles struct {
+	sync.Mutex
+	next   Handle
+	values map[Handle]interface{}
+}
+
+func newHandle(value interface{}) Handle {
+	handles.Lock()
+	defer handles.Unlock()
+
+	if handles.values == nil {
+		handles.values = make(map[Handle]interface{})
+	}
+	handles.next++
+	handles.values[handles.next] = value
+	return handles.next
+}
+
+func lookupHandle(h Handle) interface{} {
+	handles.Lock()
+	defer handles.Unlock()
+	return handles.values[h]
+}
+
+// Free releases a handle. Releasing an unknown handle is ignored.
+func Free(h Handle) {
+	handles.Lock()
+	defer handles.Unlock()
+	delete(handles.values, h)
+}
+
+// GenerateKeyPair generates a key pair for a server or an authenticating client.
+func GenerateKeyPair() (privateKey, publicKey []byte, err error) {
+	private, public, err := gopssst.GenerateKeyPair(gopssst.CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		return
+	}
+	return private.([]byte), public.([]byte), nil
+}
+
+/*
+ClientNew creates a client for the server with the given public key. If
+clientPrivateKey is empty the client is anonymous, otherwise it authenticates to the
+server with that key.
+*/
+func ClientNew(serverPublicKey, clientPrivateKey []byte) (client Handle, err error) {
+	var c gopssst.Client
+	if len(clientPrivateKey) == 0 {
+		c, err = gopssst.NewClient(gopssst.CipherSuiteX25519AESGCM, serverPublicKey, nil)
+	} else {
+		c, err = gopssst.NewClient(gopssst.CipherSuiteX25519AESGCM, serverPublicKey, clientPrivateKey)
+	}
+	if err != nil {
+		return
+	}
+	return newHandle(c), nil
+}
+
+// Pack packs data as a request, returning the packet and a handle for unpacking the reply.
+func Pack(client Handle, data []byte) (packet []byte, request Handle, err error) {
+	c, ok := lookupHandle(client).(gopssst.Client)
+	if !ok {
+		err = ErrBadHandle
+		return
+	}
+
+	packet, replyHandler, err := c.PackOutgoing(data)
+	if err != nil {
+		return
+	}
+	return packet, newHandle(clientReply(replyHandler)), nil
+}
+
+// UnpackReply unpacks the server's reply to a request, releasing the request handle if it succeeds.
+func UnpackReply(request Handle, packet []byte) (data []byte, err error) {
+	replyHandler, ok := lookupHandle(request).(clientReply)
+	if !ok {
+		err = ErrBadHandle
+		return
+	}
+
+	if data, err = replyHandler(packet); err != nil {
+		return
+	}
+	Free(request)
+	return
+}
+
+// IsRequest reports whether request is a pending request handle, without using it up.
+func IsRequest(request Handle) bool {
+	_, ok := lookupHandle(request).(clientReply)
+	return ok
+}
+
+// ServerNew creates a server with the given private key.
+func ServerNew(serverPrivateKey []byte) (server Handle, err error) {
+	s, err := gopssst.NewServer(gopssst.CipherSuiteX25519AESGCM, serverPrivateKey)
+	if err != nil {
+		return
+	}
+	return newHandle(s), nil
+}
+
+// ServerPublicKey returns a server's public key, for distribution to clients.
+func ServerPublicKey(server Handle) (publicKey []byte, err error) {
+	s, ok := lookupHandle(server).(gopssst.Server)
+	if !ok {
+		err = ErrBadHandle
+		return
+	}
+
+	key, err := s.GetServerPublicKey()
+	if err != nil {
+		return
+	}
+	return key.([]byte), nil
+}
+
+/*
+Unpack unpacks a request packet, returning the data, the public key of an authenticated
+client or nil for an anonymous one, and a handle for packing the reply.
+*/
+func Unpack(server Handle, packet []byte) (data, clientPublicKey []byte, reply Handle, err error) {
+	s, ok := lookupHandle(server).(gopssst.Server)
+	if !ok {
+		err = ErrBadHandle
+		return
+	}
+
+	data, replyHandler, clientKey, err := s.UnpackIncoming(packet)
+	if err != nil {
+		return
+	}
+	if clientKey != nil {
+		clientPublicKey = clientKey.([]byte)
+	}
+	return data, clientPublicKey, newHandle(serverReply(replyHandler)), nil
+}
+
+// Reply packs the reply to a request, releasing the reply handle if it succeeds.
+func Reply(reply Handle, data []byte) (packet []byte, err error) {
+	replyHandler, ok := lookupHandle(reply).(serverReply)
+	if !ok {
+		err = ErrBadHandle
+		return
+	}
+
+	if packet, err = replyHandler(data); err != nil {
+		return
+	}
+	Free(reply)
+	return
+}
+
+// IsReply reports whether reply is a pending reply handle, without using it up.
+func IsReply(reply Handle) bool {
+	_, ok := lookupHandle(reply).(serverReply)
+	return ok
+}
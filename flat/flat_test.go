@@ -0,0 +1,111 @@
+package flat
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundtrip(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+	clientPrivateKey, clientPublicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Generate client key failed with %s", err)
+	}
+
+	server, err := ServerNew(serverPrivateKey)
+	if err != nil {
+		t.Fatalf("Creating server failed with %s", err)
+	}
+	defer Free(server)
+	if key, err := ServerPublicKey(server); err != nil || !bytes.Equal(key, serverPublicKey) {
+		t.Errorf("Server public key did not match")
+	}
+
+	for _, privateKey := range [][]byte{nil, clientPrivateKey} {
+		client, err := ClientNew(serverPublicKey, privateKey)
+		if err != nil {
+			t.Fatalf("Creating client failed with %s", err)
+		}
+
+		packet, request, err := Pack(client, []byte("Telemetry"))
+		if err != nil {
+			t.Fatalf("Packing request failed with %s", err)
+		}
+		Free(client)
+
+		data, seenKey, reply, err := Unpack(server, packet)
+		if err != nil {
+			t.Fatalf("Unpacking request failed with %s", err)
+		}
+		if !bytes.Equal(data, []byte("Telemetry")) {
+			t.Errorf("Request data did not match")
+		}
+		if privateKey == nil && seenKey != nil {
+			t.Errorf("Anonymous client reported a public key")
+		}
+		if privateKey != nil && !bytes.Equal(seenKey, clientPublicKey) {
+			t.Errorf("Client public key did not match")
+		}
+
+		replyPacket, err := Reply(reply, []byte("OK"))
+		if err != nil {
+			t.Fatalf("Packing reply failed with %s", err)
+		}
+		if _, err = Reply(reply, []byte("OK")); err != ErrBadHandle {
+			t.Errorf("Reply handle was not released")
+		}
+
+		data, err = UnpackReply(request, replyPacket)
+		if err != nil {
+			t.Fatalf("Unpacking reply failed with %s", err)
+		}
+		if !bytes.Equal(data, []byte("OK")) {
+			t.Errorf("Reply data did not match")
+		}
+		if _, err = UnpackReply(request, replyPacket); err != ErrBadHandle {
+			t.Errorf("Request handle was not released")
+		}
+	}
+}
+
+func TestBadHandle(t *testing.T) {
+	_, serverPublicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+	client, err := ClientNew(serverPublicKey, nil)
+	if err != nil {
+		t.Fatalf("Creating client failed with %s", err)
+	}
+	defer Free(client)
+
+	if _, _, _, err = Unpack(client, nil); err != ErrBadHandle {
+		t.Errorf("Client handle accepted as a server")
+	}
+
+	packet, request, err := Pack(client, []byte("Telemetry"))
+	if err != nil {
+		t.Fatalf("Packing request failed with %s", err)
+	}
+	if _, err = Reply(request, []byte("OK")); err != ErrBadHandle {
+		t.Errorf("Request handle accepted as a reply")
+	}
+	if !IsRequest(request) || IsReply(request) || IsRequest(client) {
+		t.Errorf("Handle kinds not reported correctly")
+	}
+
+	// A reply that fails its checks leaves the request handle for the real reply
+	if _, err = UnpackReply(request, packet); err == nil || err == ErrBadHandle {
+		t.Errorf("Request packet accepted as a reply")
+	}
+	Free(request)
+	if _, err = UnpackReply(request, packet); err != ErrBadHandle {
+		t.Errorf("Freed handle still usable")
+	}
+	if IsRequest(request) {
+		t.Errorf("Freed handle reported as a request")
+	}
+}
@@ -0,0 +1,132 @@
+package gopssst
+
+import (
+	"bufio"
+	"io"
+)
+
+// frameMaxPacketSize is the largest packet that can be carried in a single frame.
+const frameMaxPacketSize = 65536
+
+// frameBufferSize is large enough to hold a COBS encoded maximum size packet.
+const frameBufferSize = frameMaxPacketSize + frameMaxPacketSize/254 + 2
+
+/*
+COBSEncode returns src encoded using Consistent Overhead Byte Stuffing. The result
+contains no zero bytes and is at most one byte longer per 254 bytes of input, plus one.
+*/
+func COBSEncode(src []byte) []byte {
+	dst := make([]byte, 1, len(src)+len(src)/254+2)
+	codeIndex := 0
+	code := byte(1)
+
+	for _, b := range src {
+		if b != 0 {
+			dst = append(dst, b)
+			code++
+		}
+		if b == 0 || code == 0xff {
+			dst[codeIndex] = code
+			codeIndex = len(dst)
+			dst = append(dst, 0)
+			code = 1
+		}
+	}
+	dst[codeIndex] = code
+
+	return dst
+}
+
+// COBSDecode reverses COBSEncode.
+func COBSDecode(src []byte) ([]byte, error) {
+	dst := make([]byte, 0, len(src))
+
+	for i := 0; i < len(src); {
+		code := int(src[i])
+		if code == 0 || i+code > len(src) {
+			return nil, &PSSSTError{"Malformed COBS data"}
+		}
+		dst = append(dst, src[i+1:i+code]...)
+		i += code
+		if code < 0xff && i < len(src) {
+			dst = append(dst, 0)
+		}
+	}
+
+	return dst, nil
+}
+
+/*
+FrameWriter writes packets to a byte stream, such as a UART or RS-485 link, as COBS
+encoded frames delimited by zero bytes.
+*/
+type FrameWriter struct {
+	w io.Writer
+}
+
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{w}
+}
+
+/*
+WriteFrame writes one packet as a single frame. Each frame is preceded as well as
+followed by a delimiter so that the receiver resynchronises after line noise.
+*/
+func (fw *FrameWriter) WriteFrame(packetBytes []byte) error {
+	if len(packetBytes) > frameMaxPacketSize {
+		return &PSSSTError{"Packet too large for framing"}
+	}
+
+	encoded := COBSEncode(packetBytes)
+	frame := make([]byte, 0, len(encoded)+2)
+	frame = append(frame, 0)
+	frame = append(frame, encoded...)
+	frame = append(frame, 0)
+
+	_, err := fw.w.Write(frame)
+	return err
+}
+
+/*
+FrameReader reads packets written by a FrameWriter from a byte stream. Empty,
+oversized and malformed frames are skipped.
+*/
+type FrameReader struct {
+	r *bufio.Reader
+}
+
+func NewFrameReader(r io.Reader) *FrameReader {
+	return &FrameReader{bufio.NewReaderSize(r, frameBufferSize)}
+}
+
+// ReadFrame returns the next packet from the stream.
+func (fr *FrameReader) ReadFrame() ([]byte, error) {
+	for {
+		frame, err := fr.r.ReadSlice(0)
+		if err == bufio.ErrBufferFull {
+			// Discard the rest of an oversized frame
+			for err == bufio.ErrBufferFull {
+				_, err = fr.r.ReadSlice(0)
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		frame = frame[:len(frame)-1]
+		if len(frame) == 0 {
+			continue
+		}
+
+		packetBytes, err := COBSDecode(frame)
+		if err != nil {
+			continue
+		}
+
+		return packetBytes, nil
+	}
+}
@@ -0,0 +1,88 @@
+package gopssst
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestCOBSVectors(t *testing.T) {
+	long := make([]byte, 254)
+	for i := range long {
+		long[i] = byte(i + 1)
+	}
+
+	vectors := []struct {
+		decoded, encoded []byte
+	}{
+		{[]byte{}, []byte{0x01}},
+		{[]byte{0x00}, []byte{0x01, 0x01}},
+		{[]byte{0x00, 0x00}, []byte{0x01, 0x01, 0x01}},
+		{[]byte{0x11, 0x22, 0x00, 0x33}, []byte{0x03, 0x11, 0x22, 0x02, 0x33}},
+		{[]byte{0x11, 0x00, 0x00, 0x00}, []byte{0x02, 0x11, 0x01, 0x01, 0x01}},
+		{long, append(append([]byte{0xff}, long...), 0x01)},
+	}
+
+	for i, v := range vectors {
+		encoded := COBSEncode(v.decoded)
+		if !bytes.Equal(encoded, v.encoded) {
+			t.Errorf("Vector %d encoded to %x", i, encoded)
+		}
+		decoded, err := COBSDecode(v.encoded)
+		if err != nil {
+			t.Errorf("Vector %d decode failed with %s", i, err)
+		}
+		if !bytes.Equal(decoded, v.decoded) {
+			t.Errorf("Vector %d decoded to %x", i, decoded)
+		}
+	}
+}
+
+func TestFrameRoundtrip(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+
+	testMessages := [][]byte{
+		[]byte("This is a test!"),
+		make([]byte, 1000),
+	}
+
+	var link bytes.Buffer
+	// Line noise before the first frame should be ignored
+	link.Write([]byte{0x42, 0x17})
+
+	writer := NewFrameWriter(&link)
+	for _, testMessage := range testMessages {
+		packet, _, err := client.PackOutgoing(testMessage)
+		if err != nil {
+			t.Fatalf("Packing request packet failed with %s", err)
+		}
+		if err = writer.WriteFrame(packet); err != nil {
+			t.Fatalf("Writing frame failed with %s", err)
+		}
+	}
+
+	reader := NewFrameReader(&link)
+	for _, testMessage := range testMessages {
+		packet, err := reader.ReadFrame()
+		if err != nil {
+			t.Fatalf("Reading frame failed with %s", err)
+		}
+		receivedMessage, _, _, err := server.UnpackIncoming(packet)
+		if err != nil {
+			t.Errorf("Unpacking request failed with %s", err)
+		}
+		if !bytes.Equal(testMessage, receivedMessage) {
+			t.Errorf("Received message did not match")
+		}
+	}
+
+	if _, err = reader.ReadFrame(); err != io.EOF {
+		t.Errorf("Expected EOF after last frame, got %v", err)
+	}
+}
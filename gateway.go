@@ -0,0 +1,109 @@
+package gopssst
+
+import (
+	"bytes"
+	"crypto"
+)
+
+/*
+Gateway bridges requests from clients using a front-facing key to a backend using a
+separate internal key, so that an edge terminator never holds the backend key. Each
+request is unpacked with the front server and repacked to the backend with the client's
+authenticated public key, if any, carried in front of the data. The backend reads it with
+UnpackFromGateway, which only trusts it in requests authenticated with the gateway's own
+client key. This prefix exists only on the gateway to backend hop, between two parties
+that both opt in to it; requests from ordinary clients never carry it.
+*/
+type Gateway struct {
+	front   Server
+	backend Client
+}
+
+/*
+NewGateway creates a gateway unpacking requests with front and repacking them for the
+backend server with the given public key. gatewayPrivateKey is the gateway's client
+key, which may be a *ClientIdentity, and is required so that the backend can tell the
+forwarded client identity came from the gateway. options configure the client used to
+reach the backend.
+*/
+func NewGateway(front Server, cipherSuite int, backendPublicKey crypto.PublicKey, gatewayPrivateKey crypto.PrivateKey, options ...ClientOption) (gateway *Gateway, err error) {
+	if identity, ok := gatewayPrivateKey.(*ClientIdentity); gatewayPrivateKey == nil || ok && identity == nil {
+		err = &PSSSTError{"Gateway requires a client private key"}
+		return
+	}
+
+	backend, err := NewClient(cipherSuite, backendPublicKey, gatewayPrivateKey, options...)
+	if err != nil {
+		return
+	}
+
+	return &Gateway{front, backend}, nil
+}
+
+/*
+Rewrap unpacks a request from a client and repacks it for the backend. The returned
+reply handler takes the backend's reply packet and returns the reply packet for the
+client. It keeps no reference to requestPacket, so the transport may reuse its buffer
+while the backend request is outstanding.
+*/
+func (g *Gateway) Rewrap(requestPacket []byte) (backendPacket []byte, replyHandler ReplyHandler, err error) {
+	data, frontReplyHandler, clientPublicKey, err := g.front.UnpackIncoming(requestPacket)
+	if err != nil {
+		return
+	}
+
+	var clientKey []byte
+	if clientPublicKey != nil {
+		clientKey = clientPublicKey.([]byte)
+	}
+
+	payload := make([]byte, 0, 1+len(clientKey)+len(data))
+	payload = append(payload, byte(len(clientKey)))
+	payload = append(payload, clientKey...)
+	payload = append(payload, data...)
+
+	var backendReplyHandler ReplyHandler
+	if backendPacket, backendReplyHandler, err = g.backend.PackOutgoing(payload); err != nil {
+		return
+	}
+
+	replyHandler = func(backendReply []byte) (reply []byte, err error) {
+		var replyData []byte
+		if replyData, err = backendReplyHandler(backendReply); err != nil {
+			return
+		}
+		return frontReplyHandler(replyData)
+	}
+
+	return
+}
+
+/*
+UnpackFromGateway unpacks a request forwarded by a Gateway whose client public key is
+gatewayPublicKey, returning the data and the public key of the original client, or nil
+if that client was anonymous. Requests not authenticated with the gateway key are
+rejected.
+*/
+func UnpackFromGateway(server Server, packetBytes []byte, gatewayPublicKey crypto.PublicKey) (data []byte, replyHandler ReplyHandler, clientPublicKey crypto.PublicKey, err error) {
+	var payload []byte
+	var senderPublicKey crypto.PublicKey
+	if payload, replyHandler, senderPublicKey, err = server.UnpackIncoming(packetBytes); err != nil {
+		return
+	}
+
+	senderKey, _ := senderPublicKey.([]byte)
+	gatewayKey, _ := gatewayPublicKey.([]byte)
+	if senderKey == nil || !bytes.Equal(senderKey, gatewayKey) {
+		return nil, nil, nil, &PSSSTError{"Request not from gateway"}
+	}
+
+	if len(payload) < 1 || len(payload) < 1+int(payload[0]) {
+		return nil, nil, nil, &PSSSTError{"Gateway request truncated"}
+	}
+	if payload[0] != 0 {
+		clientPublicKey = payload[1 : 1+payload[0]]
+	}
+	data = payload[1+payload[0]:]
+
+	return
+}
@@ -0,0 +1,123 @@
+package gopssst
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGateway(t *testing.T) {
+	frontPrivateKey, frontPublicKey, _ := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	backendPrivateKey, backendPublicKey, _ := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	gatewayPrivateKey, gatewayPublicKey, _ := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	clientPrivateKey, clientPublicKey, _ := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+
+	front, _ := NewServer(CipherSuiteX25519AESGCM, frontPrivateKey)
+	backend, _ := NewServer(CipherSuiteX25519AESGCM, backendPrivateKey)
+	gateway, err := NewGateway(front, CipherSuiteX25519AESGCM, backendPublicKey, gatewayPrivateKey)
+	if err != nil {
+		t.Fatalf("Creating gateway failed with %s", err)
+	}
+
+	for _, privateKey := range []interface{}{nil, clientPrivateKey} {
+		client, _ := NewClient(CipherSuiteX25519AESGCM, frontPublicKey, privateKey)
+		request, replyHandler, err := client.PackOutgoing([]byte("Hello"))
+		if err != nil {
+			t.Fatalf("Packing request failed with %s", err)
+		}
+
+		backendRequest, gatewayReplyHandler, err := gateway.Rewrap(request)
+		if err != nil {
+			t.Fatalf("Rewrapping request failed with %s", err)
+		}
+
+		data, backendReplyHandler, seenKey, err := UnpackFromGateway(backend, backendRequest, gatewayPublicKey)
+		if err != nil {
+			t.Fatalf("Unpacking at backend failed with %s", err)
+		}
+		if !bytes.Equal(data, []byte("Hello")) {
+			t.Errorf("Backend request data did not match")
+		}
+		if privateKey == nil && seenKey != nil {
+			t.Errorf("Anonymous client reported a public key at the backend")
+		}
+		if privateKey != nil && !bytes.Equal(seenKey.([]byte), clientPublicKey.([]byte)) {
+			t.Errorf("Client public key was not preserved through the gateway")
+		}
+
+		backendReply, _ := backendReplyHandler([]byte("World"))
+		reply, err := gatewayReplyHandler(backendReply)
+		if err != nil {
+			t.Fatalf("Rewrapping reply failed with %s", err)
+		}
+		if data, err = replyHandler(reply); err != nil || !bytes.Equal(data, []byte("World")) {
+			t.Errorf("Client did not get the backend's reply")
+		}
+	}
+}
+
+func TestGatewayReusedBuffer(t *testing.T) {
+	frontPrivateKey, frontPublicKey, _ := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	backendPrivateKey, backendPublicKey, _ := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	gatewayPrivateKey, gatewayPublicKey, _ := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+
+	front, _ := NewServer(CipherSuiteX25519AESGCM, frontPrivateKey)
+	backend, _ := NewServer(CipherSuiteX25519AESGCM, backendPrivateKey)
+	gateway, err := NewGateway(front, CipherSuiteX25519AESGCM, backendPublicKey, gatewayPrivateKey)
+	if err != nil {
+		t.Fatalf("Creating gateway failed with %s", err)
+	}
+	client, _ := NewClient(CipherSuiteX25519AESGCM, frontPublicKey, nil)
+
+	request, replyHandler, err := client.PackOutgoing([]byte("Hello"))
+	if err != nil {
+		t.Fatalf("Packing request failed with %s", err)
+	}
+	backendRequest, gatewayReplyHandler, err := gateway.Rewrap(request)
+	if err != nil {
+		t.Fatalf("Rewrapping request failed with %s", err)
+	}
+
+	// The gateway's receive buffer takes the next request while this one is at the backend
+	next, _, _ := client.PackOutgoing([]byte("Next"))
+	copy(request, next)
+
+	_, backendReplyHandler, _, err := UnpackFromGateway(backend, backendRequest, gatewayPublicKey)
+	if err != nil {
+		t.Fatalf("Unpacking at backend failed with %s", err)
+	}
+	backendReply, _ := backendReplyHandler([]byte("World"))
+	reply, err := gatewayReplyHandler(backendReply)
+	if err != nil {
+		t.Fatalf("Rewrapping reply failed with %s", err)
+	}
+	if data, err := replyHandler(reply); err != nil || !bytes.Equal(data, []byte("World")) {
+		t.Errorf("Reply did not survive the gateway reusing its buffer")
+	}
+}
+
+func TestNewGatewayRequiresClientKey(t *testing.T) {
+	frontPrivateKey, _, _ := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	_, backendPublicKey, _ := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	front, _ := NewServer(CipherSuiteX25519AESGCM, frontPrivateKey)
+
+	if _, err := NewGateway(front, CipherSuiteX25519AESGCM, backendPublicKey, nil); err == nil {
+		t.Errorf("Gateway without a client key created")
+	}
+}
+
+func TestUnpackFromGatewayRejectsOthers(t *testing.T) {
+	backendPrivateKey, backendPublicKey, _ := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	_, gatewayPublicKey, _ := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	otherPrivateKey, _, _ := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	backend, _ := NewServer(CipherSuiteX25519AESGCM, backendPrivateKey)
+
+	// A client claiming an identity in the gateway format, authenticated with the wrong key
+	forged := append([]byte{32}, make([]byte, 32)...)
+	for _, privateKey := range []interface{}{nil, otherPrivateKey} {
+		client, _ := NewClient(CipherSuiteX25519AESGCM, backendPublicKey, privateKey)
+		request, _, _ := client.PackOutgoing(forged)
+		if _, _, _, err := UnpackFromGateway(backend, request, gatewayPublicKey); err == nil {
+			t.Errorf("Backend trusted an identity not forwarded by the gateway")
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package gopssst
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// HTTPContentType is the media type used for HTTP bodies that carry PSSST packets.
+const HTTPContentType = "application/pssst"
+
+// httpMaxPacketSize limits the size of packets read from HTTP bodies.
+const httpMaxPacketSize = 1 << 20
+
+type httpContextKey struct{}
+
+/*
+HTTPTransport is an http.RoundTripper that sends the body of each request as a PSSST
+packet and decrypts the body of the response. Only the bodies are protected; the method,
+URL, status and headers travel as normal HTTP. The Content-Type of the inner request and
+response are replaced by HTTPContentType.
+*/
+type HTTPTransport struct {
+	// Client is used to pack each outgoing request body.
+	Client Client
+	// Base is the RoundTripper used to send the packets. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+}
+
+func (t *HTTPTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	var data []byte
+	if req.Body != nil {
+		data, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return
+		}
+	}
+
+	packetBytes, replyHandler, err := t.Client.PackOutgoing(data)
+	if err != nil {
+		return
+	}
+
+	outReq := req.Clone(req.Context())
+	outReq.Body = ioutil.NopCloser(bytes.NewReader(packetBytes))
+	outReq.GetBody = func() (body io.ReadCloser, err error) {
+		return ioutil.NopCloser(bytes.NewReader(packetBytes)), nil
+	}
+	outReq.ContentLength = int64(len(packetBytes))
+	outReq.Header.Set("Content-Type", HTTPContentType)
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if resp, err = base.RoundTrip(outReq); err != nil {
+		return
+	}
+
+	replyPacket, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, httpMaxPacketSize))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if !isHTTPContentType(resp.Header.Get("Content-Type")) {
+		return nil, &PSSSTError{fmt.Sprintf("HTTP response %q is not a PSSST reply", resp.Status)}
+	}
+
+	reply, err := replyHandler(replyPacket)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Header.Del("Content-Type")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(reply)))
+	resp.ContentLength = int64(len(reply))
+	resp.Body = ioutil.NopCloser(bytes.NewReader(reply))
+
+	return resp, nil
+}
+
+type httpHandler struct {
+	server  Server
+	handler http.Handler
+}
+
+/*
+NewHTTPHandler returns an http.Handler that accepts PSSST packets POSTed by an
+HTTPTransport, passes the decrypted request to handler and encrypts whatever handler
+writes as the response body. The authenticated client public key, if any, can be
+retrieved by handler using HTTPClientPublicKey.
+*/
+func NewHTTPHandler(server Server, handler http.Handler) http.Handler {
+	return &httpHandler{server, handler}
+}
+
+/*
+HTTPClientPublicKey returns the authenticated client public key of a request passed
+to the handler given to NewHTTPHandler, or nil if the client did not authenticate.
+*/
+func HTTPClientPublicKey(r *http.Request) crypto.PublicKey {
+	return r.Context().Value(httpContextKey{})
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "PSSST requests must use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isHTTPContentType(r.Header.Get("Content-Type")) {
+		http.Error(w, "Request is not a PSSST packet", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	packetBytes, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, httpMaxPacketSize))
+	if err != nil {
+		http.Error(w, "Failed to read request", http.StatusBadRequest)
+		return
+	}
+
+	data, replyHandler, clientPublicKey, err := h.server.UnpackIncoming(packetBytes)
+	if err != nil {
+		http.Error(w, "Failed to unpack request", http.StatusBadRequest)
+		return
+	}
+
+	inner := r.Clone(context.WithValue(r.Context(), httpContextKey{}, clientPublicKey))
+	inner.Header.Del("Content-Type")
+	inner.Body = ioutil.NopCloser(bytes.NewReader(data))
+	inner.ContentLength = int64(len(data))
+
+	rw := &httpReplyWriter{header: make(http.Header)}
+	h.handler.ServeHTTP(rw, inner)
+
+	reply, err := replyHandler(rw.body.Bytes())
+	if err != nil {
+		http.Error(w, "Failed to pack reply", http.StatusInternalServerError)
+		return
+	}
+
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+
+	for k, v := range rw.header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Type", HTTPContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(reply)))
+	w.WriteHeader(rw.status)
+	w.Write(reply)
+}
+
+// httpReplyWriter buffers the response of the inner handler so that it can be encrypted.
+type httpReplyWriter struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func (rw *httpReplyWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *httpReplyWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	return rw.body.Write(b)
+}
+
+func (rw *httpReplyWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+}
+
+func isHTTPContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == HTTPContentType
+}
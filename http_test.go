@@ -0,0 +1,80 @@
+package gopssst
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPRoundtrip(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+
+	clientPrivateKey, clientPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate client key failed with %s", err)
+	}
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, clientPrivateKey)
+
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientAuthKey, _ := HTTPClientPublicKey(r).([]byte)
+		if !bytes.Equal(clientAuthKey, clientPublicKey.([]byte)) {
+			t.Errorf("Client auth did not match senders")
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(body)
+	})
+
+	httpServer := httptest.NewServer(NewHTTPHandler(server, echo))
+	defer httpServer.Close()
+
+	httpClient := &http.Client{Transport: &HTTPTransport{Client: client}}
+
+	testMessage := []byte("This is a test!")
+
+	resp, err := httpClient.Post(httpServer.URL, "text/plain", bytes.NewReader(testMessage))
+	if err != nil {
+		t.Fatalf("HTTP request failed with %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Unexpected HTTP status %s", resp.Status)
+	}
+
+	receivedReply, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Errorf("Reading reply failed with %s", err)
+	}
+
+	if !bytes.Equal(testMessage, receivedReply) {
+		t.Errorf("Round-trip reply did not match")
+	}
+}
+
+func TestHTTPHandlerRejectsPlaintext(t *testing.T) {
+	serverPrivateKey, _, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+
+	handler := NewHTTPHandler(server, http.NotFoundHandler())
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte("This is a test!")))
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Plaintext request returned status %d", rec.Code)
+	}
+}
@@ -0,0 +1,71 @@
+package gopssst
+
+import (
+	"crypto"
+	"sync"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+/*
+ClientIdentity holds a client key pair along with the static DH values computed
+between it and each server it has been used with. A single ClientIdentity can be passed
+in place of the client private key to any number of NewClient calls, from any number of
+goroutines, and the two X25519 operations per server key are only done once.
+*/
+type ClientIdentity struct {
+	cipherSuite int
+	privateKey  []byte
+	publicKey   []byte
+
+	mutex    sync.Mutex
+	staticDH map[string][]byte
+}
+
+// NewClientIdentity creates an identity from a client private key for the given cipher suite.
+func NewClientIdentity(cipherSuite int, clientPrivateKey crypto.PrivateKey) (identity *ClientIdentity, err error) {
+	switch cipherSuite {
+	case CipherSuiteX25519AESGCM:
+		keyBytes, ok := clientPrivateKey.([]byte)
+		if !ok {
+			err = &PSSSTError{"Incompatible client key"}
+			return
+		}
+
+		identity = &ClientIdentity{
+			cipherSuite: cipherSuite,
+			privateKey:  keyBytes,
+			staticDH:    make(map[string][]byte),
+		}
+		if identity.publicKey, err = curve25519.X25519(keyBytes, curve25519.Basepoint); err != nil {
+			return nil, err
+		}
+	default:
+		err = &PSSSTError{"Unsuported cipher suite"}
+	}
+
+	return
+}
+
+// PublicKey returns the public key of the identity, as seen by servers.
+func (identity *ClientIdentity) PublicKey() crypto.PublicKey {
+	return identity.publicKey
+}
+
+// staticDHWith returns the static DH value between the identity and a server public key, computing it on first use.
+func (identity *ClientIdentity) staticDHWith(serverPublicKey []byte) (result []byte, err error) {
+	identity.mutex.Lock()
+	defer identity.mutex.Unlock()
+
+	result, ok := identity.staticDH[string(serverPublicKey)]
+	if ok {
+		return
+	}
+
+	if result, err = curve25519.X25519(identity.privateKey, serverPublicKey); err != nil {
+		return nil, err
+	}
+	identity.staticDH[string(serverPublicKey)] = result
+
+	return
+}
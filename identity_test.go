@@ -0,0 +1,57 @@
+package gopssst
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestClientIdentity(t *testing.T) {
+	clientPrivateKey, clientPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate client key failed with %s", err)
+	}
+
+	identity, err := NewClientIdentity(CipherSuiteX25519AESGCM, clientPrivateKey)
+	if err != nil {
+		t.Fatalf("Creating client identity failed with %s", err)
+	}
+
+	if !bytes.Equal(identity.PublicKey().([]byte), clientPublicKey.([]byte)) {
+		t.Errorf("Identity public key did not match")
+	}
+
+	for i := 0; i < 2; i++ {
+		serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+		if err != nil {
+			t.Fatalf("Generate server key failed with %s", err)
+		}
+
+		server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+
+		// Several clients for the same server share one static DH computation
+		for j := 0; j < 3; j++ {
+			client, err := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, identity)
+			if err != nil {
+				t.Fatalf("Creating client failed with %s", err)
+			}
+
+			outgoingPacket, _, err := client.PackOutgoing([]byte("This is a test!"))
+			if err != nil {
+				t.Fatalf("Packing request packet failed with %s", err)
+			}
+
+			_, _, clientAuthKey, err := server.UnpackIncoming(outgoingPacket)
+			if err != nil {
+				t.Fatalf("Unpacking request key failed with %s", err)
+			}
+
+			if !bytes.Equal(clientAuthKey.([]byte), clientPublicKey.([]byte)) {
+				t.Errorf("Client auth did not match senders")
+			}
+		}
+	}
+
+	if len(identity.staticDH) != 2 {
+		t.Errorf("Identity cached %d static DH values, expected 2", len(identity.staticDH))
+	}
+}
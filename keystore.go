@@ -0,0 +1,199 @@
+package gopssst
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const (
+	keyStoreMagic      = "PSSK"
+	keyStoreHeaderSize = 12
+)
+
+/*
+KeyStore persists a device's client identity in a form that survives power loss part
+way through a write. It keeps two slot files, path.0 and path.1, each holding a
+generation count, the cipher suite and the private key, protected by a CRC-32. Writes
+go to the slot not holding the current key, so a torn write leaves the previous key
+intact, and the newest valid slot is the one loaded. After a slot is written both the
+file and its directory are synced, so a newly created slot is not lost either. Storing
+the key already held is skipped, to save flash erase cycles.
+*/
+type KeyStore struct {
+	path string
+}
+
+// NewKeyStore returns a key store using the slot files path.0 and path.1.
+func NewKeyStore(path string) *KeyStore {
+	return &KeyStore{path}
+}
+
+type keyStoreSlot struct {
+	generation  uint32
+	cipherSuite uint16
+	privateKey  []byte
+}
+
+func (store *KeyStore) slotPath(slot int) string {
+	return store.path + []string{".0", ".1"}[slot]
+}
+
+func encodeKeyStoreSlot(s keyStoreSlot) []byte {
+	record := make([]byte, keyStoreHeaderSize, keyStoreHeaderSize+len(s.privateKey)+4)
+	copy(record, keyStoreMagic)
+	binary.BigEndian.PutUint32(record[4:8], s.generation)
+	binary.BigEndian.PutUint16(record[8:10], s.cipherSuite)
+	binary.BigEndian.PutUint16(record[10:12], uint16(len(s.privateKey)))
+	record = append(record, s.privateKey...)
+
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(record))
+	return append(record, crc[:]...)
+}
+
+func decodeKeyStoreSlot(record []byte) (s keyStoreSlot, ok bool) {
+	if len(record) < keyStoreHeaderSize+4 || !bytes.Equal(record[:4], []byte(keyStoreMagic)) {
+		return
+	}
+	keyLength := int(binary.BigEndian.Uint16(record[10:12]))
+	if len(record) != keyStoreHeaderSize+keyLength+4 {
+		return
+	}
+	body := record[:len(record)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(record[len(body):]) {
+		return
+	}
+
+	s.generation = binary.BigEndian.Uint32(record[4:8])
+	s.cipherSuite = binary.BigEndian.Uint16(record[8:10])
+	s.privateKey = append([]byte{}, body[keyStoreHeaderSize:]...)
+	return s, true
+}
+
+/*
+newest returns the index and contents of the newest valid slot, or -1 if neither is
+valid, and whether any slot file exists at all. A slot that fails to read for any reason
+other than not existing is an error rather than being treated as absent.
+*/
+func (store *KeyStore) newest() (index int, current keyStoreSlot, present bool, err error) {
+	index = -1
+	for i := 0; i < 2; i++ {
+		record, readErr := ioutil.ReadFile(store.slotPath(i))
+		if os.IsNotExist(readErr) {
+			continue
+		}
+		if readErr != nil {
+			index, err = -1, readErr
+			return
+		}
+		present = true
+		s, ok := decodeKeyStoreSlot(record)
+		if !ok {
+			continue
+		}
+		// Generations are compared with serial number arithmetic so the count can wrap
+		if index < 0 || int32(s.generation-current.generation) > 0 {
+			index, current = i, s
+		}
+	}
+	return
+}
+
+// Load returns the stored client identity, for passing to NewClient.
+func (store *KeyStore) Load() (identity *ClientIdentity, err error) {
+	index, current, present, err := store.newest()
+	if err != nil {
+		return
+	}
+	if index < 0 {
+		if present {
+			err = &PSSSTError{"No valid key in key store"}
+		} else {
+			err = &PSSSTError{"Key store is empty"}
+		}
+		return
+	}
+	return NewClientIdentity(int(current.cipherSuite), current.privateKey)
+}
+
+// Store saves the private key of identity as the new current key.
+func (store *KeyStore) Store(identity *ClientIdentity) (err error) {
+	index, current, _, err := store.newest()
+	if err != nil {
+		return
+	}
+	if index >= 0 && int(current.cipherSuite) == identity.cipherSuite && bytes.Equal(current.privateKey, identity.privateKey) {
+		return
+	}
+
+	record := encodeKeyStoreSlot(keyStoreSlot{current.generation + 1, uint16(identity.cipherSuite), identity.privateKey})
+
+	f, err := os.OpenFile(store.slotPath((index+1)%2), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+	if _, err = f.Write(record); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = syncDir(filepath.Dir(store.path))
+	}
+
+	return
+}
+
+// syncDir makes a newly created file in dir durable.
+func syncDir(dir string) (err error) {
+	// Windows can't sync a directory, and its file metadata is journaled with the file
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+
+	return
+}
+
+/*
+Provision returns the stored client identity, first generating and storing a new one
+for the given cipher suite if neither slot file exists. It is the usual way for a device
+to obtain its identity at startup. If the slots can't be read, or exist but hold no
+valid key, it returns an error rather than replacing the device's identity.
+*/
+func (store *KeyStore) Provision(cipherSuite int) (identity *ClientIdentity, err error) {
+	_, _, present, err := store.newest()
+	if err != nil {
+		return
+	}
+	if present {
+		return store.Load()
+	}
+
+	privateKey, _, err := GenerateKeyPair(cipherSuite, nil)
+	if err != nil {
+		return
+	}
+	if identity, err = NewClientIdentity(cipherSuite, privateKey); err != nil {
+		return
+	}
+	if err = store.Store(identity); err != nil {
+		identity = nil
+	}
+
+	return
+}
@@ -0,0 +1,140 @@
+package gopssst
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatalf("Creating temp dir failed with %s", err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewKeyStore(filepath.Join(dir, "identity"))
+
+	if _, err = store.Load(); err == nil {
+		t.Errorf("Empty key store loaded")
+	}
+
+	first, err := store.Provision(CipherSuiteX25519AESGCM)
+	if err != nil {
+		t.Fatalf("Provisioning failed with %s", err)
+	}
+	again, err := store.Provision(CipherSuiteX25519AESGCM)
+	if err != nil || !bytes.Equal(again.PublicKey().([]byte), first.PublicKey().([]byte)) {
+		t.Errorf("Provisioning a provisioned store changed the key")
+	}
+
+	privateKey, _, _ := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	second, _ := NewClientIdentity(CipherSuiteX25519AESGCM, privateKey)
+	if err = store.Store(second); err != nil {
+		t.Fatalf("Storing key failed with %s", err)
+	}
+	loaded, err := store.Load()
+	if err != nil || !bytes.Equal(loaded.PublicKey().([]byte), second.PublicKey().([]byte)) {
+		t.Errorf("Loaded key was not the newest stored")
+	}
+
+	// A torn write of the newest slot falls back to the previous key
+	record, _ := ioutil.ReadFile(store.slotPath(1))
+	ioutil.WriteFile(store.slotPath(1), record[:len(record)-5], 0600)
+	loaded, err = store.Load()
+	if err != nil || !bytes.Equal(loaded.PublicKey().([]byte), first.PublicKey().([]byte)) {
+		t.Errorf("Key store did not fall back to the previous key")
+	}
+
+	// A corrupted slot is ignored just like a torn one
+	record[keyStoreHeaderSize] ^= 1
+	ioutil.WriteFile(store.slotPath(1), record, 0600)
+	loaded, err = store.Load()
+	if err != nil || !bytes.Equal(loaded.PublicKey().([]byte), first.PublicKey().([]byte)) {
+		t.Errorf("Key store loaded a corrupted slot")
+	}
+}
+
+func TestKeyStoreSkipsUnchangedKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatalf("Creating temp dir failed with %s", err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewKeyStore(filepath.Join(dir, "identity"))
+
+	identity, err := store.Provision(CipherSuiteX25519AESGCM)
+	if err != nil {
+		t.Fatalf("Provisioning failed with %s", err)
+	}
+	if err = store.Store(identity); err != nil {
+		t.Fatalf("Storing key failed with %s", err)
+	}
+	if _, err = os.Stat(store.slotPath(1)); !os.IsNotExist(err) {
+		t.Errorf("Storing the current key wrote a slot")
+	}
+}
+
+func TestKeyStoreGenerationWrap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatalf("Creating temp dir failed with %s", err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewKeyStore(filepath.Join(dir, "identity"))
+
+	keys := make([][]byte, 2)
+	for i := range keys {
+		keys[i] = bytes.Repeat([]byte{byte(i + 1)}, 32)
+	}
+	ioutil.WriteFile(store.slotPath(0), encodeKeyStoreSlot(keyStoreSlot{0xffffffff, CipherSuiteX25519AESGCM, keys[0]}), 0600)
+	ioutil.WriteFile(store.slotPath(1), encodeKeyStoreSlot(keyStoreSlot{0, CipherSuiteX25519AESGCM, keys[1]}), 0600)
+
+	if index, _, _, _ := store.newest(); index != 1 {
+		t.Errorf("Wrapped generation was not treated as newest")
+	}
+}
+
+func TestKeyStoreErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatalf("Creating temp dir failed with %s", err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewKeyStore(filepath.Join(dir, "identity"))
+
+	if _, err = store.Provision(CipherSuiteX25519AESGCM); err != nil {
+		t.Fatalf("Provisioning failed with %s", err)
+	}
+	record, err := ioutil.ReadFile(store.slotPath(0))
+	if err != nil {
+		t.Fatalf("Reading slot failed with %s", err)
+	}
+
+	// A slot that can't be read is an error, not a missing key
+	if err = os.Mkdir(store.slotPath(1), 0700); err != nil {
+		t.Fatalf("Creating directory failed with %s", err)
+	}
+	if _, err = store.Load(); err == nil {
+		t.Errorf("Unreadable slot ignored by Load")
+	}
+	if _, err = store.Provision(CipherSuiteX25519AESGCM); err == nil {
+		t.Errorf("Unreadable slot ignored by Provision")
+	}
+	os.Remove(store.slotPath(1))
+
+	// Slots that exist but hold no valid key are not replaced with a new identity
+	record[keyStoreHeaderSize] ^= 1
+	for i := 0; i < 2; i++ {
+		if err = ioutil.WriteFile(store.slotPath(i), record, 0600); err != nil {
+			t.Fatalf("Writing slot failed with %s", err)
+		}
+	}
+	if _, err = store.Provision(CipherSuiteX25519AESGCM); err == nil {
+		t.Errorf("Provisioning replaced corrupted slots")
+	}
+	if corrupted, _ := ioutil.ReadFile(store.slotPath(0)); !bytes.Equal(corrupted, record) {
+		t.Errorf("Provisioning overwrote a corrupted slot")
+	}
+}
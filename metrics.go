@@ -0,0 +1,104 @@
+package gopssst
+
+import (
+	"time"
+)
+
+// Stage identifies a step of packet processing for instrumentation.
+type Stage int
+
+const (
+	// StageKeyGen is the generation of an ephemeral session secret.
+	StageKeyGen Stage = iota
+	// StageDH covers the X25519 operations.
+	StageDH
+	// StageKDF is the derivation of the symmetric key and nonces.
+	StageKDF
+	// StageAEAD covers AEAD set-up and the encryption or decryption of the payload.
+	StageAEAD
+)
+
+func (s Stage) String() string {
+	switch s {
+	case StageKeyGen:
+		return "keygen"
+	case StageDH:
+		return "dh"
+	case StageKDF:
+		return "kdf"
+	case StageAEAD:
+		return "aead"
+	}
+	return "unknown"
+}
+
+// Operation identifies a complete packet operation for instrumentation.
+type Operation int
+
+const (
+	// OperationPack is packing a request at the client.
+	OperationPack Operation = iota
+	// OperationUnpack is unpacking a request at the server.
+	OperationUnpack
+	// OperationReply is packing a reply at the server.
+	OperationReply
+	// OperationUnpackReply is unpacking a reply at the client.
+	OperationUnpackReply
+)
+
+func (o Operation) String() string {
+	switch o {
+	case OperationPack:
+		return "pack"
+	case OperationUnpack:
+		return "unpack"
+	case OperationReply:
+		return "reply"
+	case OperationUnpackReply:
+		return "unpack_reply"
+	}
+	return "unknown"
+}
+
+/*
+Metrics receives instrumentation from clients and servers created with
+WithClientMetrics or WithServerMetrics. Implementations must be safe for concurrent
+use and should be cheap, since they are called several times for every packet.
+Allocations are not reported: counting them per packet needs runtime.ReadMemStats,
+which stops the world, so use the benchmarks with -benchmem to measure them instead.
+*/
+type Metrics interface {
+	// ObserveStage reports the time taken by one stage of processing a packet.
+	ObserveStage(stage Stage, duration time.Duration)
+	// ObserveOperation is called exactly once per operation, successful or not, with
+	// its total latency. err is the error the operation returned, if any.
+	ObserveOperation(operation Operation, duration time.Duration, err error)
+}
+
+// observeOperation is deferred at the start of an operation with the address of its error result.
+func observeOperation(metrics Metrics, operation Operation, start time.Time, err *error) {
+	metrics.ObserveOperation(operation, time.Since(start), *err)
+}
+
+// stageTimer times consecutive stages. With nil metrics it does nothing, not even read the clock.
+type stageTimer struct {
+	metrics Metrics
+	start   time.Time
+}
+
+func startStages(metrics Metrics) stageTimer {
+	if metrics == nil {
+		return stageTimer{}
+	}
+	return stageTimer{metrics, time.Now()}
+}
+
+// end reports the time since the previous stage ended, or since the timer started.
+func (t *stageTimer) end(stage Stage) {
+	if t.metrics == nil {
+		return
+	}
+	now := time.Now()
+	t.metrics.ObserveStage(stage, now.Sub(t.start))
+	t.start = now
+}
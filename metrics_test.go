@@ -0,0 +1,136 @@
+package gopssst
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type countingMetrics struct {
+	mutex      sync.Mutex
+	stages     map[Stage]int
+	operations map[Operation]int
+	failures   map[Operation]int
+}
+
+func newCountingMetrics() *countingMetrics {
+	return &countingMetrics{
+		stages:     make(map[Stage]int),
+		operations: make(map[Operation]int),
+		failures:   make(map[Operation]int),
+	}
+}
+
+func (m *countingMetrics) ObserveStage(stage Stage, duration time.Duration) {
+	m.mutex.Lock()
+	m.stages[stage]++
+	m.mutex.Unlock()
+}
+
+func (m *countingMetrics) ObserveOperation(operation Operation, duration time.Duration, err error) {
+	m.mutex.Lock()
+	m.operations[operation]++
+	if err != nil {
+		m.failures[operation]++
+	}
+	m.mutex.Unlock()
+}
+
+func TestStageMetrics(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+
+	clientPrivateKey, _, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate client key failed with %s", err)
+	}
+
+	serverMetrics := newCountingMetrics()
+	clientMetrics := newCountingMetrics()
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey, WithServerMetrics(serverMetrics))
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, clientPrivateKey, WithClientMetrics(clientMetrics))
+
+	outgoingPacket, clientReplyHandler, err := client.PackOutgoing([]byte("This is a test!"))
+	if err != nil {
+		t.Fatalf("Packing request packet failed with %s", err)
+	}
+
+	receivedMessage, serverReplyHandler, _, err := server.UnpackIncoming(outgoingPacket)
+	if err != nil {
+		t.Fatalf("Unpacking request key failed with %s", err)
+	}
+
+	replyPacket, err := serverReplyHandler(receivedMessage)
+	if err != nil {
+		t.Fatalf("Packing reply packet failed with %s", err)
+	}
+
+	if _, err = clientReplyHandler(replyPacket); err != nil {
+		t.Fatalf("Unacking reply packet failed with %s", err)
+	}
+
+	expectedClient := map[Stage]int{StageKeyGen: 1, StageDH: 1, StageKDF: 1, StageAEAD: 2}
+	expectedServer := map[Stage]int{StageDH: 2, StageKDF: 1, StageAEAD: 2}
+
+	for stage, count := range expectedClient {
+		if clientMetrics.stages[stage] != count {
+			t.Errorf("Client reported stage %s %d times, expected %d", stage, clientMetrics.stages[stage], count)
+		}
+	}
+	for stage, count := range expectedServer {
+		if serverMetrics.stages[stage] != count {
+			t.Errorf("Server reported stage %s %d times, expected %d", stage, serverMetrics.stages[stage], count)
+		}
+	}
+}
+
+func TestOperationMetrics(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+
+	serverMetrics := newCountingMetrics()
+	clientMetrics := newCountingMetrics()
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey, WithServerMetrics(serverMetrics))
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil, WithClientMetrics(clientMetrics))
+
+	outgoingPacket, clientReplyHandler, err := client.PackOutgoing([]byte("This is a test!"))
+	if err != nil {
+		t.Fatalf("Packing request packet failed with %s", err)
+	}
+
+	receivedMessage, serverReplyHandler, _, err := server.UnpackIncoming(outgoingPacket)
+	if err != nil {
+		t.Fatalf("Unpacking request key failed with %s", err)
+	}
+
+	// A corrupted packet should be counted as a failed unpack
+	outgoingPacket[len(outgoingPacket)-1] ^= 1
+	if _, _, _, err = server.UnpackIncoming(outgoingPacket); err == nil {
+		t.Errorf("Corrupted packet unpacked without error")
+	}
+
+	replyPacket, err := serverReplyHandler(receivedMessage)
+	if err != nil {
+		t.Fatalf("Packing reply packet failed with %s", err)
+	}
+
+	if _, err = clientReplyHandler(replyPacket); err != nil {
+		t.Fatalf("Unacking reply packet failed with %s", err)
+	}
+
+	if clientMetrics.operations[OperationPack] != 1 || clientMetrics.operations[OperationUnpackReply] != 1 {
+		t.Errorf("Unexpected client operation counts %v", clientMetrics.operations)
+	}
+	if serverMetrics.operations[OperationUnpack] != 2 || serverMetrics.operations[OperationReply] != 1 {
+		t.Errorf("Unexpected server operation counts %v", serverMetrics.operations)
+	}
+	if serverMetrics.failures[OperationUnpack] != 1 {
+		t.Errorf("Expected one failed unpack, got %d", serverMetrics.failures[OperationUnpack])
+	}
+}
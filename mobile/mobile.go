@@ -0,0 +1,156 @@
+/*
+Package mobile is a facade over gopssst for use with gomobile. It uses only the types
+gomobile can bind: byte slices, strings, errors and pointers to structs whose methods
+take and return those. Keys are the raw 32 byte X25519 keys used throughout gopssst,
+so mobile clients can share server keys with Go backends.
+
+Build the bindings with:
+
+	gomobile bind -target=android github.com/nickovs/gopssst/mobile
+	gomobile bind -target=ios github.com/nickovs/gopssst/mobile
+
+Byte slices passed in belong to the caller, and the host language may change or free
+them after the call returns, so any that are kept are copied first.
+*/
+package mobile
+
+import (
+	"github.com/nickovs/gopssst"
+)
+
+// KeyPair is a newly generated key pair.
+type KeyPair struct {
+	privateKey, publicKey []byte
+}
+
+// PrivateKey returns the private key. It must be kept secret.
+func (k *KeyPair) PrivateKey() []byte {
+	return k.privateKey
+}
+
+// PublicKey returns the public key.
+func (k *KeyPair) PublicKey() []byte {
+	return k.publicKey
+}
+
+// clone copies a byte slice passed in by the caller that is kept after the call returns.
+func clone(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
+
+// GenerateKeyPair generates a key pair for a server or an authenticating client.
+func GenerateKeyPair() (*KeyPair, error) {
+	privateKey, publicKey, err := gopssst.GenerateKeyPair(gopssst.CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyPair{privateKey.([]byte), publicKey.([]byte)}, nil
+}
+
+// Client packs requests for one server.
+type Client struct {
+	client gopssst.Client
+}
+
+/*
+NewClient creates a client for the server with the given public key. If
+clientPrivateKey is empty the client is anonymous, otherwise it authenticates to the
+server with that key.
+*/
+func NewClient(serverPublicKey []byte, clientPrivateKey []byte) (*Client, error) {
+	var client gopssst.Client
+	var err error
+	if len(clientPrivateKey) == 0 {
+		client, err = gopssst.NewClient(gopssst.CipherSuiteX25519AESGCM, clone(serverPublicKey), nil)
+	} else {
+		client, err = gopssst.NewClient(gopssst.CipherSuiteX25519AESGCM, clone(serverPublicKey), clone(clientPrivateKey))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Client{client}, nil
+}
+
+// Request is a packed request, holding what is needed to unpack its reply.
+type Request struct {
+	packet       []byte
+	replyHandler gopssst.ReplyHandler
+}
+
+// Pack packs data as a request.
+func (c *Client) Pack(data []byte) (*Request, error) {
+	packet, replyHandler, err := c.client.PackOutgoing(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Request{packet, replyHandler}, nil
+}
+
+// Packet returns the request packet to send to the server.
+func (r *Request) Packet() []byte {
+	return r.packet
+}
+
+// UnpackReply unpacks the server's reply to this request. It can only succeed once.
+func (r *Request) UnpackReply(replyPacket []byte) ([]byte, error) {
+	return r.replyHandler(replyPacket)
+}
+
+// Server unpacks requests sent to one key.
+type Server struct {
+	server gopssst.Server
+}
+
+// NewServer creates a server with the given private key.
+func NewServer(serverPrivateKey []byte) (*Server, error) {
+	server, err := gopssst.NewServer(gopssst.CipherSuiteX25519AESGCM, clone(serverPrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	return &Server{server}, nil
+}
+
+// PublicKey returns the server's public key, for distribution to clients.
+func (s *Server) PublicKey() ([]byte, error) {
+	publicKey, err := s.server.GetServerPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return publicKey.([]byte), nil
+}
+
+// IncomingRequest is an unpacked request, holding what is needed to pack the reply.
+type IncomingRequest struct {
+	data            []byte
+	clientPublicKey []byte
+	replyHandler    gopssst.ReplyHandler
+}
+
+// Unpack unpacks a request packet.
+func (s *Server) Unpack(packet []byte) (*IncomingRequest, error) {
+	data, replyHandler, clientPublicKey, err := s.server.UnpackIncoming(packet)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &IncomingRequest{data: data, replyHandler: replyHandler}
+	if clientPublicKey != nil {
+		request.clientPublicKey = clientPublicKey.([]byte)
+	}
+	return request, nil
+}
+
+// Data returns the request data.
+func (r *IncomingRequest) Data() []byte {
+	return r.data
+}
+
+// ClientPublicKey returns the public key of an authenticated client, or nil for an anonymous one.
+func (r *IncomingRequest) ClientPublicKey() []byte {
+	return r.clientPublicKey
+}
+
+// Reply packs the reply to this request. It can only be called once.
+func (r *IncomingRequest) Reply(data []byte) ([]byte, error) {
+	return r.replyHandler(data)
+}
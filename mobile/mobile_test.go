@@ -0,0 +1,133 @@
+package mobile
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundtrip(t *testing.T) {
+	serverKeys, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+	clientKeys, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Generate client key failed with %s", err)
+	}
+
+	server, err := NewServer(serverKeys.PrivateKey())
+	if err != nil {
+		t.Fatalf("Creating server failed with %s", err)
+	}
+	serverPublicKey, err := server.PublicKey()
+	if err != nil || !bytes.Equal(serverPublicKey, serverKeys.PublicKey()) {
+		t.Errorf("Server public key did not match")
+	}
+
+	for _, clientPrivateKey := range [][]byte{nil, clientKeys.PrivateKey()} {
+		client, err := NewClient(serverKeys.PublicKey(), clientPrivateKey)
+		if err != nil {
+			t.Fatalf("Creating client failed with %s", err)
+		}
+
+		request, err := client.Pack([]byte("Telemetry"))
+		if err != nil {
+			t.Fatalf("Packing request failed with %s", err)
+		}
+
+		incoming, err := server.Unpack(request.Packet())
+		if err != nil {
+			t.Fatalf("Unpacking request failed with %s", err)
+		}
+		if !bytes.Equal(incoming.Data(), []byte("Telemetry")) {
+			t.Errorf("Request data did not match")
+		}
+		if (clientPrivateKey == nil) != (incoming.ClientPublicKey() == nil) {
+			t.Errorf("Client public key presence did not match client auth")
+		}
+		if clientPrivateKey != nil && !bytes.Equal(incoming.ClientPublicKey(), clientKeys.PublicKey()) {
+			t.Errorf("Client public key did not match")
+		}
+
+		replyPacket, err := incoming.Reply([]byte("OK"))
+		if err != nil {
+			t.Fatalf("Packing reply failed with %s", err)
+		}
+		reply, err := request.UnpackReply(replyPacket)
+		if err != nil {
+			t.Fatalf("Unpacking reply failed with %s", err)
+		}
+		if !bytes.Equal(reply, []byte("OK")) {
+			t.Errorf("Reply data did not match")
+		}
+	}
+}
+
+// scribble overwrites a buffer, as the host language may do once a call has returned.
+func scribble(b []byte) {
+	for i := range b {
+		b[i] = 0xff
+	}
+}
+
+func TestArgumentsNotRetained(t *testing.T) {
+	serverKeys, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+	clientKeys, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Generate client key failed with %s", err)
+	}
+
+	serverPrivateKey := append([]byte(nil), serverKeys.PrivateKey()...)
+	server, err := NewServer(serverPrivateKey)
+	if err != nil {
+		t.Fatalf("Creating server failed with %s", err)
+	}
+	scribble(serverPrivateKey)
+
+	serverPublicKey := append([]byte(nil), serverKeys.PublicKey()...)
+	clientPrivateKey := append([]byte(nil), clientKeys.PrivateKey()...)
+	client, err := NewClient(serverPublicKey, clientPrivateKey)
+	if err != nil {
+		t.Fatalf("Creating client failed with %s", err)
+	}
+	scribble(serverPublicKey)
+	scribble(clientPrivateKey)
+
+	data := []byte("Telemetry")
+	request, err := client.Pack(data)
+	if err != nil {
+		t.Fatalf("Packing request failed with %s", err)
+	}
+	scribble(data)
+
+	packet := append([]byte(nil), request.Packet()...)
+	incoming, err := server.Unpack(packet)
+	if err != nil {
+		t.Fatalf("Unpacking request failed with %s", err)
+	}
+	scribble(packet)
+	if !bytes.Equal(incoming.Data(), []byte("Telemetry")) {
+		t.Errorf("Request data did not match")
+	}
+	if !bytes.Equal(incoming.ClientPublicKey(), clientKeys.PublicKey()) {
+		t.Errorf("Client public key did not match")
+	}
+
+	replyData := []byte("OK")
+	replyPacket, err := incoming.Reply(replyData)
+	if err != nil {
+		t.Fatalf("Packing reply failed with %s", err)
+	}
+	scribble(replyData)
+
+	reply, err := request.UnpackReply(replyPacket)
+	if err != nil {
+		t.Fatalf("Unpacking reply failed with %s", err)
+	}
+	if !bytes.Equal(reply, []byte("OK")) {
+		t.Errorf("Reply data did not match")
+	}
+}
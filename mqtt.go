@@ -0,0 +1,58 @@
+package gopssst
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+)
+
+/*
+SealMQTTPayload packs an MQTT publish payload for the subscriber whose public key the
+client was created with. The topic name is carried inside the encrypted packet so that
+a broker cannot move the message to a different topic without detection. Since MQTT has
+no reply path the reply handler is discarded.
+*/
+func SealMQTTPayload(client Client, topic string, payload []byte) (packetBytes []byte, err error) {
+	if len(topic) > 0xffff {
+		err = &PSSSTError{"MQTT topic too long"}
+		return
+	}
+
+	data := make([]byte, 2+len(topic)+len(payload))
+	binary.BigEndian.PutUint16(data, uint16(len(topic)))
+	copy(data[2:], topic)
+	copy(data[2+len(topic):], payload)
+
+	packetBytes, _, err = client.PackOutgoing(data)
+	return
+}
+
+/*
+OpenMQTTPayload unpacks an MQTT publish payload created by SealMQTTPayload. The topic
+must be the topic name on which the message was received; if it does not match the
+topic the message was sealed for an error is returned. If the publisher used client
+authentication its public key is returned.
+*/
+func OpenMQTTPayload(server Server, topic string, packetBytes []byte) (payload []byte, clientPublicKey crypto.PublicKey, err error) {
+	var data []byte
+	if data, _, clientPublicKey, err = server.UnpackIncoming(packetBytes); err != nil {
+		return
+	}
+
+	if len(data) < 2 {
+		err = &PSSSTError{"MQTT payload truncated"}
+		return
+	}
+	topicLength := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+topicLength {
+		err = &PSSSTError{"MQTT payload truncated"}
+		return
+	}
+	if !bytes.Equal(data[2:2+topicLength], []byte(topic)) {
+		err = &PSSSTError{"MQTT topic mismatch"}
+		return
+	}
+
+	payload = data[2+topicLength:]
+	return
+}
@@ -0,0 +1,41 @@
+package gopssst
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMQTTPayload(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+
+	testMessage := []byte("This is a test!")
+
+	packet, err := SealMQTTPayload(client, "sensors/1/temperature", testMessage)
+	if err != nil {
+		t.Fatalf("Sealing MQTT payload failed with %s", err)
+	}
+
+	receivedMessage, clientAuthKey, err := OpenMQTTPayload(server, "sensors/1/temperature", packet)
+	if err != nil {
+		t.Errorf("Opening MQTT payload failed with %s", err)
+	}
+
+	if clientAuthKey != nil {
+		t.Errorf("Client auth found but not provided")
+	}
+
+	if !bytes.Equal(testMessage, receivedMessage) {
+		t.Errorf("Received message did not match")
+	}
+
+	_, _, err = OpenMQTTPayload(server, "sensors/2/temperature", packet)
+	if err == nil {
+		t.Errorf("MQTT payload opened on the wrong topic")
+	}
+}
@@ -0,0 +1,261 @@
+package gopssst
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+)
+
+/*
+Packet is the parsed form of a PSSST packet: the cleartext header fields, the DH param
+and the ciphertext, which includes the AEAD tag. It converts between the binary wire
+format and JSON, CBOR or protocol buffer envelopes, for carrying packets inside existing
+APIs and message queues. No cryptographic checks are made on conversion.
+
+In JSON the fields are named flags, suite, dh_param and ciphertext, with the byte
+fields base64 encoded. The CBOR form is a map with the same keys, using byte strings,
+in the deterministic encoding of RFC 8949 section 4.2.
+*/
+type Packet struct {
+	Flags       uint16 `json:"flags"`
+	CipherSuite uint16 `json:"suite"`
+	DHParam     []byte `json:"dh_param"`
+	Ciphertext  []byte `json:"ciphertext"`
+}
+
+func (p *Packet) check() error {
+	if len(p.DHParam) != 32 {
+		return &PSSSTError{"Packet DH param must be 32 bytes"}
+	}
+	return nil
+}
+
+// MarshalBinary returns the packet in the wire format.
+func (p *Packet) MarshalBinary() (packetBytes []byte, err error) {
+	if err = p.check(); err != nil {
+		return
+	}
+
+	packetBytes = make([]byte, 36+len(p.Ciphertext))
+	header{p.Flags, p.CipherSuite}.encode(packetBytes[:headerSize])
+	copy(packetBytes[4:36], p.DHParam)
+	copy(packetBytes[36:], p.Ciphertext)
+
+	return
+}
+
+// UnmarshalBinary parses a packet in the wire format. The fields are copies, not references into packetBytes.
+func (p *Packet) UnmarshalBinary(packetBytes []byte) (err error) {
+	var h PacketHeader
+	if h, err = PeekHeader(packetBytes); err != nil {
+		return
+	}
+
+	p.Flags = h.Flags
+	p.CipherSuite = h.CipherSuite
+	p.DHParam = append([]byte{}, h.DHParam...)
+	p.Ciphertext = append([]byte{}, packetBytes[36:]...)
+
+	return
+}
+
+// UnmarshalJSON strictly decodes the JSON form: all fields are required and unknown fields are rejected.
+func (p *Packet) UnmarshalJSON(data []byte) (err error) {
+	var fields struct {
+		Flags       *uint16 `json:"flags"`
+		CipherSuite *uint16 `json:"suite"`
+		DHParam     []byte  `json:"dh_param"`
+		Ciphertext  []byte  `json:"ciphertext"`
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&fields); err != nil {
+		return
+	}
+	if fields.Flags == nil || fields.CipherSuite == nil || fields.Ciphertext == nil {
+		return &PSSSTError{"Packet JSON missing field"}
+	}
+
+	decoded := Packet{*fields.Flags, *fields.CipherSuite, fields.DHParam, fields.Ciphertext}
+	if err = decoded.check(); err != nil {
+		return
+	}
+	*p = decoded
+
+	return
+}
+
+// CBOR major types used by the packet envelope
+const (
+	cborUnsigned   = 0
+	cborByteString = 2
+	cborTextString = 3
+	cborMap        = 5
+)
+
+// The map keys in deterministic order: shorter encodings first, then bytewise.
+var cborPacketKeys = []string{"flags", "suite", "dh_param", "ciphertext"}
+
+func cborAppendHead(b []byte, majorType byte, value uint64) []byte {
+	major := majorType << 5
+	switch {
+	case value < 24:
+		return append(b, major|byte(value))
+	case value <= 0xff:
+		return append(b, major|24, byte(value))
+	case value <= 0xffff:
+		return append(b, major|25, byte(value>>8), byte(value))
+	case value <= 0xffffffff:
+		b = append(b, major|26)
+		return append(b, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+	}
+	b = append(b, major|27)
+	var v [8]byte
+	binary.BigEndian.PutUint64(v[:], value)
+	return append(b, v[:]...)
+}
+
+// MarshalCBOR returns the CBOR form of the packet.
+func (p *Packet) MarshalCBOR() (encoded []byte, err error) {
+	if err = p.check(); err != nil {
+		return
+	}
+
+	encoded = make([]byte, 0, 64+len(p.Ciphertext))
+	encoded = cborAppendHead(encoded, cborMap, uint64(len(cborPacketKeys)))
+	for _, key := range cborPacketKeys {
+		encoded = cborAppendHead(encoded, cborTextString, uint64(len(key)))
+		encoded = append(encoded, key...)
+
+		switch key {
+		case "flags":
+			encoded = cborAppendHead(encoded, cborUnsigned, uint64(p.Flags))
+		case "suite":
+			encoded = cborAppendHead(encoded, cborUnsigned, uint64(p.CipherSuite))
+		case "dh_param":
+			encoded = cborAppendHead(encoded, cborByteString, uint64(len(p.DHParam)))
+			encoded = append(encoded, p.DHParam...)
+		case "ciphertext":
+			encoded = cborAppendHead(encoded, cborByteString, uint64(len(p.Ciphertext)))
+			encoded = append(encoded, p.Ciphertext...)
+		}
+	}
+
+	return
+}
+
+// cborReadHead reads the initial byte and argument of a data item, rejecting non-minimal arguments.
+func cborReadHead(b []byte) (majorType byte, value uint64, rest []byte, err error) {
+	if len(b) == 0 {
+		err = &PSSSTError{"CBOR data truncated"}
+		return
+	}
+	majorType = b[0] >> 5
+	info := b[0] & 0x1f
+	b = b[1:]
+
+	var size int
+	switch {
+	case info < 24:
+		return majorType, uint64(info), b, nil
+	case info <= 27:
+		size = 1 << (info - 24)
+	default:
+		err = &PSSSTError{"CBOR indefinite lengths not supported"}
+		return
+	}
+
+	if len(b) < size {
+		err = &PSSSTError{"CBOR data truncated"}
+		return
+	}
+	for _, c := range b[:size] {
+		value = value<<8 | uint64(c)
+	}
+	rest = b[size:]
+
+	if (size == 1 && value < 24) || (size > 1 && value < 1<<(uint(size)*4)) {
+		err = &PSSSTError{"CBOR argument not minimally encoded"}
+	}
+
+	return
+}
+
+func cborReadBytes(b []byte, wantType byte) (data []byte, rest []byte, err error) {
+	var majorType byte
+	var length uint64
+	if majorType, length, rest, err = cborReadHead(b); err != nil {
+		return
+	}
+	if majorType != wantType {
+		err = &PSSSTError{"CBOR unexpected type"}
+		return
+	}
+	if uint64(len(rest)) < length {
+		err = &PSSSTError{"CBOR data truncated"}
+		return
+	}
+	return rest[:length], rest[length:], nil
+}
+
+/*
+UnmarshalCBOR strictly decodes the CBOR form. Only the deterministic encoding produced by
+MarshalCBOR is accepted: all four keys in order, minimal lengths and no trailing data.
+*/
+func (p *Packet) UnmarshalCBOR(encoded []byte) (err error) {
+	majorType, count, rest, err := cborReadHead(encoded)
+	if err != nil {
+		return
+	}
+	if majorType != cborMap || count != uint64(len(cborPacketKeys)) {
+		return &PSSSTError{"CBOR packet must be a map of 4 entries"}
+	}
+
+	var decoded Packet
+	for _, key := range cborPacketKeys {
+		var found []byte
+		if found, rest, err = cborReadBytes(rest, cborTextString); err != nil {
+			return
+		}
+		if string(found) != key {
+			return &PSSSTError{"CBOR packet has unexpected key " + string(found)}
+		}
+
+		switch key {
+		case "flags", "suite":
+			var value uint64
+			if majorType, value, rest, err = cborReadHead(rest); err != nil {
+				return
+			}
+			if majorType != cborUnsigned || value > 0xffff {
+				return &PSSSTError{"CBOR packet " + key + " must be a 16 bit unsigned integer"}
+			}
+			if key == "flags" {
+				decoded.Flags = uint16(value)
+			} else {
+				decoded.CipherSuite = uint16(value)
+			}
+		case "dh_param":
+			if found, rest, err = cborReadBytes(rest, cborByteString); err != nil {
+				return
+			}
+			decoded.DHParam = append([]byte{}, found...)
+		case "ciphertext":
+			if found, rest, err = cborReadBytes(rest, cborByteString); err != nil {
+				return
+			}
+			decoded.Ciphertext = append([]byte{}, found...)
+		}
+	}
+
+	if len(rest) != 0 {
+		return &PSSSTError{"CBOR packet has trailing data"}
+	}
+	if err = decoded.check(); err != nil {
+		return
+	}
+	*p = decoded
+
+	return
+}
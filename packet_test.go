@@ -0,0 +1,212 @@
+package gopssst
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func testPackets(t *testing.T) [][]byte {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+	clientPrivateKey, _, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate client key failed with %s", err)
+	}
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, clientPrivateKey)
+
+	request, _, err := client.PackOutgoing(bytes.Repeat([]byte("x"), 300))
+	if err != nil {
+		t.Fatalf("Packing request packet failed with %s", err)
+	}
+	_, replyHandler, _, err := server.UnpackIncoming(request)
+	if err != nil {
+		t.Fatalf("Unpacking request packet failed with %s", err)
+	}
+	reply, err := replyHandler(nil)
+	if err != nil {
+		t.Fatalf("Packing reply packet failed with %s", err)
+	}
+
+	return [][]byte{request, reply}
+}
+
+func TestPacketJSONRoundtrip(t *testing.T) {
+	for _, packetBytes := range testPackets(t) {
+		var p Packet
+		if err := p.UnmarshalBinary(packetBytes); err != nil {
+			t.Fatalf("Parsing packet failed with %s", err)
+		}
+
+		encoded, err := json.Marshal(&p)
+		if err != nil {
+			t.Fatalf("JSON encoding failed with %s", err)
+		}
+
+		var decoded Packet
+		if err = json.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatalf("JSON decoding failed with %s", err)
+		}
+		roundtrip, err := decoded.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Binary encoding failed with %s", err)
+		}
+		if !bytes.Equal(roundtrip, packetBytes) {
+			t.Errorf("JSON round trip changed the packet")
+		}
+	}
+}
+
+func TestPacketCBORRoundtrip(t *testing.T) {
+	for _, packetBytes := range testPackets(t) {
+		var p Packet
+		if err := p.UnmarshalBinary(packetBytes); err != nil {
+			t.Fatalf("Parsing packet failed with %s", err)
+		}
+
+		encoded, err := p.MarshalCBOR()
+		if err != nil {
+			t.Fatalf("CBOR encoding failed with %s", err)
+		}
+
+		var decoded Packet
+		if err = decoded.UnmarshalCBOR(encoded); err != nil {
+			t.Fatalf("CBOR decoding failed with %s", err)
+		}
+		roundtrip, err := decoded.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Binary encoding failed with %s", err)
+		}
+		if !bytes.Equal(roundtrip, packetBytes) {
+			t.Errorf("CBOR round trip changed the packet")
+		}
+	}
+}
+
+func TestPacketCBOREncoding(t *testing.T) {
+	p := Packet{
+		Flags:       flagsReply,
+		CipherSuite: CipherSuiteX25519AESGCM,
+		DHParam:     make([]byte, 32),
+		Ciphertext:  []byte{1, 2, 3},
+	}
+
+	encoded, err := p.MarshalCBOR()
+	if err != nil {
+		t.Fatalf("CBOR encoding failed with %s", err)
+	}
+
+	expected := "a4" +
+		"65" + hex.EncodeToString([]byte("flags")) + "198000" +
+		"65" + hex.EncodeToString([]byte("suite")) + "01" +
+		"68" + hex.EncodeToString([]byte("dh_param")) + "5820" + hex.EncodeToString(make([]byte, 32)) +
+		"6a" + hex.EncodeToString([]byte("ciphertext")) + "43010203"
+	if hex.EncodeToString(encoded) != expected {
+		t.Errorf("Unexpected CBOR encoding %x", encoded)
+	}
+
+	bad := map[string][]byte{
+		"trailing data":     append(append([]byte{}, encoded...), 0),
+		"truncated":         encoded[:len(encoded)-1],
+		"non-minimal suite": bytes.Replace(encoded, []byte("suite\x01"), []byte("suite\x18\x01"), 1),
+		"wrong key order":   bytes.Replace(bytes.Replace(encoded, []byte("flags"), []byte("fxxxx"), 1), []byte("suite"), []byte("flags"), 1),
+	}
+	for name, b := range bad {
+		var decoded Packet
+		if err = decoded.UnmarshalCBOR(b); err == nil {
+			t.Errorf("CBOR with %s was accepted", name)
+		}
+	}
+}
+
+func TestPacketJSONStrict(t *testing.T) {
+	valid := `{"flags":0,"suite":1,"dh_param":"` + "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=" + `","ciphertext":"AQID"}`
+
+	var p Packet
+	if err := json.Unmarshal([]byte(valid), &p); err != nil {
+		t.Fatalf("Valid JSON rejected with %s", err)
+	}
+
+	bad := []string{
+		`{"flags":0,"suite":1,"dh_param":"AAAA","ciphertext":"AQID"}`,
+		`{"suite":1,"dh_param":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=","ciphertext":"AQID"}`,
+		`{"flags":0,"suite":1,"dh_param":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=","ciphertext":"AQID","extra":1}`,
+		`{"flags":70000,"suite":1,"dh_param":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=","ciphertext":"AQID"}`,
+	}
+	for _, s := range bad {
+		if err := json.Unmarshal([]byte(s), &p); err == nil {
+			t.Errorf("Invalid JSON accepted: %s", s)
+		}
+	}
+}
+
+func TestPacketProtoRoundtrip(t *testing.T) {
+	for _, packetBytes := range testPackets(t) {
+		var p Packet
+		if err := p.UnmarshalBinary(packetBytes); err != nil {
+			t.Fatalf("Parsing packet failed with %s", err)
+		}
+
+		encoded, err := p.MarshalProto()
+		if err != nil {
+			t.Fatalf("Protobuf encoding failed with %s", err)
+		}
+
+		var decoded Packet
+		if err = decoded.UnmarshalProto(encoded); err != nil {
+			t.Fatalf("Protobuf decoding failed with %s", err)
+		}
+		roundtrip, err := decoded.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Binary encoding failed with %s", err)
+		}
+		if !bytes.Equal(roundtrip, packetBytes) {
+			t.Errorf("Protobuf round trip changed the packet")
+		}
+	}
+}
+
+func TestPacketProtoEncoding(t *testing.T) {
+	p := Packet{
+		Flags:       flagsReply,
+		CipherSuite: CipherSuiteX25519AESGCM,
+		DHParam:     make([]byte, 32),
+		Ciphertext:  []byte{1, 2, 3},
+	}
+
+	encoded, err := p.MarshalProto()
+	if err != nil {
+		t.Fatalf("Protobuf encoding failed with %s", err)
+	}
+
+	expected := "08808002" + "1001" + "1a20" + hex.EncodeToString(make([]byte, 32)) + "2203010203"
+	if hex.EncodeToString(encoded) != expected {
+		t.Errorf("Unexpected protobuf encoding %x", encoded)
+	}
+
+	// Unknown fields are skipped
+	withUnknown := append([]byte{0x28, 0x07, 0x32, 0x01, 0xff}, encoded...)
+	var decoded Packet
+	if err = decoded.UnmarshalProto(withUnknown); err != nil {
+		t.Fatalf("Protobuf with unknown fields rejected with %s", err)
+	}
+	if decoded.Flags != p.Flags || !bytes.Equal(decoded.Ciphertext, p.Ciphertext) {
+		t.Errorf("Protobuf with unknown fields decoded wrongly: %+v", decoded)
+	}
+
+	bad := map[string][]byte{
+		"truncated":        encoded[:len(encoded)-1],
+		"wrong wire type":  append([]byte{0x19, 0, 0, 0, 0, 0, 0, 0, 0}, encoded...),
+		"missing DH param": encoded[:6],
+	}
+	for name, b := range bad {
+		if err = decoded.UnmarshalProto(b); err == nil {
+			t.Errorf("Protobuf with %s was accepted", name)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package gopssst
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPaddingPolicies(t *testing.T) {
+	block, err := PadToBlock(16)
+	if err != nil {
+		t.Fatalf("Creating block policy failed with %s", err)
+	}
+
+	cases := []struct {
+		name     string
+		policy   PaddingPolicy
+		lengths  []int
+		expected []int
+	}{
+		{"block", block, []int{1, 16, 17, 100}, []int{16, 16, 32, 112}},
+		{"power of two", PadToPowerOfTwo, []int{1, 2, 3, 9, 64, 65}, []int{1, 2, 4, 16, 64, 128}},
+		{"padme", Padme, []int{1, 7, 9, 100, 1000, 1025}, []int{1, 7, 10, 104, 1024, 1088}},
+	}
+
+	for _, c := range cases {
+		for i, length := range c.lengths {
+			if padded := c.policy(length); padded != c.expected[i] {
+				t.Errorf("%s policy padded %d to %d, expected %d", c.name, length, padded, c.expected[i])
+			}
+		}
+	}
+
+	for _, size := range []int{0, -16} {
+		if _, err := PadToBlock(size); err == nil {
+			t.Errorf("Block size %d accepted", size)
+		}
+	}
+}
+
+func TestUnpad(t *testing.T) {
+	for _, bad := range [][]byte{{}, {0, 0}, {0x80, 1}, {1, 2, 0}} {
+		if _, err := Unpad(bad); err == nil {
+			t.Errorf("Invalid padding %x accepted", bad)
+		}
+	}
+
+	data, err := Unpad([]byte{1, 0x80, 0x80, 0, 0})
+	if err != nil || !bytes.Equal(data, []byte{1, 0x80}) {
+		t.Errorf("Data ending in 0x80 was not unpadded correctly")
+	}
+}
+
+func TestRoundtripPadding(t *testing.T) {
+	policy, err := PadToBlock(32)
+	if err != nil {
+		t.Fatalf("Creating block policy failed with %s", err)
+	}
+
+	for _, message := range [][]byte{{}, []byte("Hello"), bytes.Repeat([]byte{0x80}, 31), bytes.Repeat([]byte{0}, 32)} {
+		padded := Pad(message, policy)
+		if len(padded)%32 != 0 || len(padded) <= len(message) {
+			t.Errorf("Message of %d bytes padded to %d bytes", len(message), len(padded))
+		}
+
+		data, err := Unpad(padded)
+		if err != nil {
+			t.Fatalf("Unpadding failed with %s", err)
+		}
+		if !bytes.Equal(data, message) {
+			t.Errorf("Data did not match after padding")
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package gopssst
+
+import (
+	"crypto"
+	"runtime"
+	"sync"
+)
+
+// UnpackResult holds the outcome of unpacking one request packet.
+type UnpackResult struct {
+	Data            []byte
+	ReplyHandler    ReplyHandler
+	ClientPublicKey crypto.PublicKey
+	Err             error
+	// Tag is the value passed to Submit with the packet, for instance the sender's address.
+	Tag interface{}
+}
+
+type pipelineJob struct {
+	packetBytes []byte
+	tag         interface{}
+	done        chan UnpackResult
+}
+
+/*
+Pipeline unpacks incoming request packets on a pool of worker goroutines. The curve
+operations make unpacking CPU-bound, so a receive loop can Submit packets as they
+arrive and have the results delivered to a single consumer reading from Results.
+*/
+type Pipeline struct {
+	server  Server
+	input   chan *pipelineJob
+	order   chan *pipelineJob
+	results chan UnpackResult
+	workers sync.WaitGroup
+}
+
+/*
+NewPipeline starts a pipeline with the given number of workers. If ordered is true
+results are delivered in the order the packets were submitted, otherwise they are
+delivered as soon as each one completes.
+*/
+func NewPipeline(server Server, workers int, ordered bool) *Pipeline {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &Pipeline{
+		server:  server,
+		input:   make(chan *pipelineJob, workers),
+		results: make(chan UnpackResult, workers),
+	}
+
+	p.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+
+	if ordered {
+		p.order = make(chan *pipelineJob, workers)
+		go func() {
+			for job := range p.order {
+				p.results <- <-job.done
+			}
+			close(p.results)
+		}()
+	} else {
+		go func() {
+			p.workers.Wait()
+			close(p.results)
+		}()
+	}
+
+	return p
+}
+
+func (p *Pipeline) work() {
+	defer p.workers.Done()
+
+	for job := range p.input {
+		var r UnpackResult
+		r.Data, r.ReplyHandler, r.ClientPublicKey, r.Err = p.server.UnpackIncoming(job.packetBytes)
+		r.Tag = job.tag
+
+		if job.done != nil {
+			job.done <- r
+		} else {
+			p.results <- r
+		}
+	}
+}
+
+/*
+Submit queues a packet for unpacking. It blocks if all the workers are busy and the
+queue is full. The packet must not be modified until its result has been delivered,
+but the result keeps no reference to it, so the caller may then reuse the buffer before
+sending the reply.
+*/
+func (p *Pipeline) Submit(packetBytes []byte, tag interface{}) {
+	job := &pipelineJob{packetBytes: packetBytes, tag: tag}
+	if p.order != nil {
+		job.done = make(chan UnpackResult, 1)
+		p.order <- job
+	}
+	p.input <- job
+}
+
+// Results returns the channel on which results are delivered. It is closed after Close once all results are delivered.
+func (p *Pipeline) Results() <-chan UnpackResult {
+	return p.results
+}
+
+// Close indicates that no more packets will be submitted.
+func (p *Pipeline) Close() {
+	close(p.input)
+	if p.order != nil {
+		close(p.order)
+	}
+}
+
+/*
+UnpackBatch unpacks a batch of request packets, such as those returned by a single
+recvmmsg call, spreading the work across the available CPUs. The result at each index
+corresponds to the packet at the same index. The results keep no reference to the
+packets, so their buffers may be reused as soon as UnpackBatch returns.
+*/
+func UnpackBatch(server Server, packets [][]byte) []UnpackResult {
+	results := make([]UnpackResult, len(packets))
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(packets) {
+		workers = len(packets)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(packets); i += workers {
+				r := &results[i]
+				r.Data, r.ReplyHandler, r.ClientPublicKey, r.Err = server.UnpackIncoming(packets[i])
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	return results
+}
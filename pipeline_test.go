@@ -0,0 +1,191 @@
+package gopssst
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func testPipeline(t *testing.T, ordered bool) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+
+	const count = 50
+
+	packets := make([][]byte, count)
+	for i := range packets {
+		packets[i], _, err = client.PackOutgoing([]byte(fmt.Sprintf("Message %d", i)))
+		if err != nil {
+			t.Fatalf("Packing request packet failed with %s", err)
+		}
+	}
+
+	pipeline := NewPipeline(server, 4, ordered)
+	go func() {
+		for i, packet := range packets {
+			pipeline.Submit(packet, i)
+		}
+		pipeline.Close()
+	}()
+
+	seen := make(map[int]bool)
+	next := 0
+	for r := range pipeline.Results() {
+		i := r.Tag.(int)
+		if r.Err != nil {
+			t.Errorf("Unpacking packet %d failed with %s", i, r.Err)
+		}
+		if !bytes.Equal(r.Data, []byte(fmt.Sprintf("Message %d", i))) {
+			t.Errorf("Result %d did not match", i)
+		}
+		if ordered && i != next {
+			t.Errorf("Got result %d, expected %d", i, next)
+		}
+		seen[i] = true
+		next++
+	}
+
+	if len(seen) != count {
+		t.Errorf("Got %d distinct results, expected %d", len(seen), count)
+	}
+}
+
+func TestPipelineOrdered(t *testing.T) {
+	testPipeline(t, true)
+}
+
+func TestPipelineUnordered(t *testing.T) {
+	testPipeline(t, false)
+}
+
+func TestPipelineReusedBuffer(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+	server, err := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	if err != nil {
+		t.Fatalf("Creating server failed with %s", err)
+	}
+	client, err := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+	if err != nil {
+		t.Fatalf("Creating client failed with %s", err)
+	}
+
+	pipeline := NewPipeline(server, 2, true)
+	defer pipeline.Close()
+
+	// A receive loop reads every packet into the same buffer
+	buf := make([]byte, 1500)
+	packet, replyHandler, err := client.PackOutgoing([]byte("Hello"))
+	if err != nil {
+		t.Fatalf("Packing request packet failed with %s", err)
+	}
+	n := copy(buf, packet)
+	pipeline.Submit(buf[:n], nil)
+	r := <-pipeline.Results()
+	if r.Err != nil {
+		t.Fatalf("Unpacking packet failed with %s", r.Err)
+	}
+
+	other, _, err := client.PackOutgoing([]byte("World"))
+	if err != nil {
+		t.Fatalf("Packing request packet failed with %s", err)
+	}
+	copy(buf, other)
+
+	reply, err := r.ReplyHandler([]byte("Re: Hello"))
+	if err != nil {
+		t.Fatalf("Packing reply failed with %s", err)
+	}
+	if data, err := replyHandler(reply); err != nil || !bytes.Equal(data, []byte("Re: Hello")) {
+		t.Errorf("Reply did not survive the request buffer being reused")
+	}
+}
+
+func TestUnpackBatch(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+
+	packets := make([][]byte, 20)
+	for i := range packets {
+		packets[i], _, err = client.PackOutgoing([]byte(fmt.Sprintf("Message %d", i)))
+		if err != nil {
+			t.Fatalf("Packing request packet failed with %s", err)
+		}
+	}
+	// A corrupt packet should fail on its own without affecting the others
+	packets[7] = packets[7][:40]
+
+	results := UnpackBatch(server, packets)
+
+	for i, r := range results {
+		if i == 7 {
+			if r.Err == nil {
+				t.Errorf("Corrupt packet unpacked without error")
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Errorf("Unpacking packet %d failed with %s", i, r.Err)
+		}
+		if !bytes.Equal(r.Data, []byte(fmt.Sprintf("Message %d", i))) {
+			t.Errorf("Result %d did not match", i)
+		}
+	}
+}
+
+func TestUnpackBatchReusedBuffers(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+	server, err := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	if err != nil {
+		t.Fatalf("Creating server failed with %s", err)
+	}
+	client, err := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+	if err != nil {
+		t.Fatalf("Creating client failed with %s", err)
+	}
+
+	packets := make([][]byte, 8)
+	replyHandlers := make([]ReplyHandler, len(packets))
+	for i := range packets {
+		if packets[i], replyHandlers[i], err = client.PackOutgoing([]byte(fmt.Sprintf("Message %d", i))); err != nil {
+			t.Fatalf("Packing request packet failed with %s", err)
+		}
+	}
+
+	results := UnpackBatch(server, packets)
+
+	// Pooled receive buffers are overwritten by the next batch before the replies go out
+	for _, packet := range packets {
+		for i := range packet {
+			packet[i] = 0
+		}
+	}
+
+	for i, r := range results {
+		if r.Err != nil {
+			t.Fatalf("Unpacking packet %d failed with %s", i, r.Err)
+		}
+		reply, err := r.ReplyHandler(r.Data)
+		if err != nil {
+			t.Fatalf("Packing reply %d failed with %s", i, err)
+		}
+		if data, err := replyHandlers[i](reply); err != nil || !bytes.Equal(data, r.Data) {
+			t.Errorf("Reply %d did not survive the request buffer being reused", i)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package gopssst
+
+import (
+	"encoding/binary"
+)
+
+// Protocol buffer wire types used by the Packet message in proto/pssst.proto
+const (
+	protoVarint          = 0
+	protoFixed64         = 1
+	protoLengthDelimited = 2
+	protoFixed32         = 5
+)
+
+// Field numbers of the Packet message
+const (
+	protoFieldFlags      = 1
+	protoFieldSuite      = 2
+	protoFieldDHParam    = 3
+	protoFieldCiphertext = 4
+)
+
+func protoAppendVarint(b []byte, value uint64) []byte {
+	var v [binary.MaxVarintLen64]byte
+	return append(b, v[:binary.PutUvarint(v[:], value)]...)
+}
+
+func protoAppendTag(b []byte, field int, wireType int) []byte {
+	return protoAppendVarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+/*
+MarshalProto returns the packet as a protocol buffer Packet message, as defined in
+proto/pssst.proto. As proto3 requires, zero flags and an empty ciphertext are omitted.
+*/
+func (p *Packet) MarshalProto() (encoded []byte, err error) {
+	if err = p.check(); err != nil {
+		return
+	}
+
+	encoded = make([]byte, 0, 48+len(p.Ciphertext))
+	if p.Flags != 0 {
+		encoded = protoAppendTag(encoded, protoFieldFlags, protoVarint)
+		encoded = protoAppendVarint(encoded, uint64(p.Flags))
+	}
+	if p.CipherSuite != 0 {
+		encoded = protoAppendTag(encoded, protoFieldSuite, protoVarint)
+		encoded = protoAppendVarint(encoded, uint64(p.CipherSuite))
+	}
+	encoded = protoAppendTag(encoded, protoFieldDHParam, protoLengthDelimited)
+	encoded = protoAppendVarint(encoded, uint64(len(p.DHParam)))
+	encoded = append(encoded, p.DHParam...)
+	if len(p.Ciphertext) != 0 {
+		encoded = protoAppendTag(encoded, protoFieldCiphertext, protoLengthDelimited)
+		encoded = protoAppendVarint(encoded, uint64(len(p.Ciphertext)))
+		encoded = append(encoded, p.Ciphertext...)
+	}
+
+	return
+}
+
+func protoReadVarint(b []byte) (value uint64, rest []byte, err error) {
+	value, n := binary.Uvarint(b)
+	if n <= 0 {
+		err = &PSSSTError{"Protobuf varint invalid"}
+		return
+	}
+	return value, b[n:], nil
+}
+
+/*
+UnmarshalProto decodes a protocol buffer Packet message. Following protobuf rules,
+fields may appear in any order, the last occurrence of a field wins and unknown fields
+are skipped.
+*/
+func (p *Packet) UnmarshalProto(encoded []byte) (err error) {
+	var decoded Packet
+
+	for rest := encoded; len(rest) > 0; {
+		var tag, value uint64
+		if tag, rest, err = protoReadVarint(rest); err != nil {
+			return
+		}
+		field, wireType := tag>>3, tag&7
+
+		var data []byte
+		switch wireType {
+		case protoVarint:
+			if value, rest, err = protoReadVarint(rest); err != nil {
+				return
+			}
+		case protoLengthDelimited:
+			if value, rest, err = protoReadVarint(rest); err != nil {
+				return
+			}
+			if uint64(len(rest)) < value {
+				return &PSSSTError{"Protobuf data truncated"}
+			}
+			data, rest = rest[:value], rest[value:]
+		case protoFixed64, protoFixed32:
+			size := 8
+			if wireType == protoFixed32 {
+				size = 4
+			}
+			if len(rest) < size {
+				return &PSSSTError{"Protobuf data truncated"}
+			}
+			rest = rest[size:]
+		default:
+			return &PSSSTError{"Protobuf wire type not supported"}
+		}
+
+		wantType := uint64(protoVarint)
+		if field == protoFieldDHParam || field == protoFieldCiphertext {
+			wantType = protoLengthDelimited
+		}
+		if field >= protoFieldFlags && field <= protoFieldCiphertext && wireType != wantType {
+			return &PSSSTError{"Protobuf field has wrong wire type"}
+		}
+
+		switch field {
+		case protoFieldFlags, protoFieldSuite:
+			if value > 0xffff {
+				return &PSSSTError{"Protobuf packet header field out of range"}
+			}
+			if field == protoFieldFlags {
+				decoded.Flags = uint16(value)
+			} else {
+				decoded.CipherSuite = uint16(value)
+			}
+		case protoFieldDHParam:
+			decoded.DHParam = append([]byte{}, data...)
+		case protoFieldCiphertext:
+			decoded.Ciphertext = append([]byte{}, data...)
+		}
+	}
+
+	if err = decoded.check(); err != nil {
+		return
+	}
+	*p = decoded
+
+	return
+}
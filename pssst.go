@@ -22,7 +22,7 @@ package gopssst
 
 import (
 	"crypto"
-	"crypto/rand"
+	"encoding/binary"
 	"io"
 )
 
@@ -30,6 +30,25 @@ type header struct {
 	Flags, CipherSuite uint16
 }
 
+const headerSize = 4
+
+func (h header) encode(b []byte) {
+	binary.BigEndian.PutUint16(b[0:2], h.Flags)
+	binary.BigEndian.PutUint16(b[2:4], h.CipherSuite)
+}
+
+func decodeHeader(b []byte) (h header, err error) {
+	if len(b) < headerSize {
+		err = &PSSSTError{"Packet too short"}
+		return
+	}
+
+	h.Flags = binary.BigEndian.Uint16(b[0:2])
+	h.CipherSuite = binary.BigEndian.Uint16(b[2:4])
+
+	return
+}
+
 const (
 	flagsReply      = 1 << 15
 	flagsClientAuth = 1 << 14
@@ -47,6 +66,14 @@ reply message (when used at the client).
 type ReplyHandler func(data []byte) (reply []byte, err error)
 
 type Server interface {
+	// UnpackIncoming decrypts a request packet, returning the request data, a handler to
+	// pack the reply and, if the client authenticated, the client public key.
+	//
+	// Packets are checked for a valid header, cipher suite and minimum length before any
+	// allocation or curve operation. A garbage packet that passes those checks costs one
+	// X25519 operation, one SHA-256 and one failed AES-GCM open over the packet; the
+	// second X25519 operation needed for client auth is only done once the AEAD tag has
+	// been verified, so an unauthenticated sender cannot trigger it.
 	UnpackIncoming(packetBytes []byte) (data []byte, replyHandler ReplyHandler, clientPublicKey crypto.PublicKey, err error)
 	GetServerPublicKey() (key crypto.PublicKey, err error)
 }
@@ -55,7 +82,26 @@ type Client interface {
 	PackOutgoing(data []byte) (packetBytes []byte, replyHandler ReplyHandler, err error)
 }
 
-func NewServer(cipherSuite int, serverPrivateKey crypto.PrivateKey) (server Server, err error) {
+// ServerOption configures optional behaviour of a Server.
+type ServerOption func(config *serverConfig)
+
+type serverConfig struct {
+	metrics Metrics
+}
+
+// WithServerMetrics reports the server's instrumentation to metrics.
+func WithServerMetrics(metrics Metrics) ServerOption {
+	return func(config *serverConfig) {
+		config.metrics = metrics
+	}
+}
+
+func NewServer(cipherSuite int, serverPrivateKey crypto.PrivateKey, options ...ServerOption) (server Server, err error) {
+	var config serverConfig
+	for _, option := range options {
+		option(&config)
+	}
+
 	switch cipherSuite {
 	case CipherSuiteX25519AESGCM:
 		keyBytes, ok := serverPrivateKey.([]byte)
@@ -64,8 +110,11 @@ func NewServer(cipherSuite int, serverPrivateKey crypto.PrivateKey) (server Serv
 			return
 		}
 
-		serverStruct := serverX22519AESGCM128{keyBytes, nil}
-		server = &serverStruct
+		var serverStruct *serverX22519AESGCM128
+		if serverStruct, err = newServerX25519AESGCM128(keyBytes, &config); err != nil {
+			return
+		}
+		server = serverStruct
 	default:
 		err = &PSSSTError{"Unsuported cipher suite"}
 	}
@@ -73,7 +122,57 @@ func NewServer(cipherSuite int, serverPrivateKey crypto.PrivateKey) (server Serv
 	return
 }
 
-func NewClient(cipherSuite int, serverPublicKey crypto.PublicKey, clientPrivateKey crypto.PrivateKey) (client Client, err error) {
+// ClientOption configures optional behaviour of a Client.
+type ClientOption func(config *clientConfig)
+
+type clientConfig struct {
+	ephemeralPoolSize int
+	metrics           Metrics
+	random            io.Reader
+}
+
+/*
+WithEphemeralPool makes the client pre-generate up to size ephemeral keys, along with
+the DH operations that depend on them, in the background. PackOutgoing then only has
+to do the symmetric work unless a burst of requests empties the pool.
+*/
+func WithEphemeralPool(size int) ClientOption {
+	return func(config *clientConfig) {
+		config.ephemeralPoolSize = size
+	}
+}
+
+// WithClientMetrics reports the client's instrumentation to metrics.
+func WithClientMetrics(metrics Metrics) ClientOption {
+	return func(config *clientConfig) {
+		config.metrics = metrics
+	}
+}
+
+/*
+WithClientRandom makes the client read its session secrets from random instead of the
+default source set with SetRandom. It exists so that test vectors can be generated
+deterministically; a client reusing session secrets loses all of its security. random
+must be safe for concurrent use if the client is used concurrently or has an ephemeral
+pool.
+*/
+func WithClientRandom(random io.Reader) ClientOption {
+	return func(config *clientConfig) {
+		config.random = random
+	}
+}
+
+/*
+NewClient creates a client that packs requests for the server with the given public key.
+If clientPrivateKey is not nil the client authenticates itself to the server; it may be
+either a private key or a *ClientIdentity shared between many clients.
+*/
+func NewClient(cipherSuite int, serverPublicKey crypto.PublicKey, clientPrivateKey crypto.PrivateKey, options ...ClientOption) (client Client, err error) {
+	var config clientConfig
+	for _, option := range options {
+		option(&config)
+	}
+
 	switch cipherSuite {
 	case CipherSuiteX25519AESGCM:
 		serverKeyBytes, ok := serverPublicKey.([]byte)
@@ -82,17 +181,26 @@ func NewClient(cipherSuite int, serverPublicKey crypto.PublicKey, clientPrivateK
 			return
 		}
 
-		var clientKeyBytes []byte
-		if clientPrivateKey != nil {
-			clientKeyBytes, ok = clientPrivateKey.([]byte)
-			if !ok {
-				err = &PSSSTError{"Incompatible client key"}
+		var identity *ClientIdentity
+		switch key := clientPrivateKey.(type) {
+		case nil:
+		case *ClientIdentity:
+			if key.cipherSuite != cipherSuite {
+				err = &PSSSTError{"Incompatible client identity"}
+				return
+			}
+			identity = key
+		default:
+			if identity, err = NewClientIdentity(cipherSuite, key); err != nil {
 				return
 			}
 		}
 
-		clientStruct := clientX25519AESGCM128{serverKeyBytes, clientKeyBytes, nil, nil}
-		client = &clientStruct
+		var clientStruct *clientX25519AESGCM128
+		if clientStruct, err = newClientX25519AESGCM128(serverKeyBytes, identity, &config); err != nil {
+			return
+		}
+		client = clientStruct
 	default:
 		err = &PSSSTError{"Unsuported cipher suite"}
 	}
@@ -101,10 +209,6 @@ func NewClient(cipherSuite int, serverPublicKey crypto.PublicKey, clientPrivateK
 }
 
 func GenerateKeyPair(cipherSuite int, random io.Reader) (privateKey crypto.PrivateKey, publicKey crypto.PublicKey, err error) {
-	if random == nil {
-		random = rand.Reader
-	}
-
 	switch cipherSuite {
 	case CipherSuiteX25519AESGCM:
 		privateKey, publicKey, err = generateX22519Pair(random)
@@ -230,6 +230,25 @@ func BenchmarkPackRequestClientAuth(b *testing.B) {
 	}
 }
 
+func BenchmarkPackRequestEphemeralPool(b *testing.B) {
+	_, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		b.Errorf("Generate server key failed with %s", err)
+	}
+
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil, WithEphemeralPool(256))
+
+	testMessage := []byte("This is a test!")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err = client.PackOutgoing(testMessage)
+		if err != nil {
+			b.Errorf("Making request packet failed with: %s", err)
+		}
+	}
+}
+
 func BenchmarkUnpackIncoming(b *testing.B) {
 	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
 	if err != nil {
@@ -323,9 +342,50 @@ func BenchmarkUnpackAndReply(b *testing.B) {
 	}
 }
 
-type prepackedReplies struct {
-	replyPacket []byte
-	handler     ReplyHandler
+/*
+benchmarkPackAndUnpackReply times packing requests and unpacking their replies, with the
+server's work in between untimed. Reply handlers can only be used once, so replies can't
+be built once and reused, and opening a reply costs so little next to the exchange that
+builds it that timing it alone would spend almost all the run building replies. The work
+is done in chunks so the timer is only stopped once per chunk.
+*/
+func benchmarkPackAndUnpackReply(b *testing.B, client Client, server Server, message []byte) {
+	const chunk = 100
+	packets := make([][]byte, chunk)
+	handlers := make([]ReplyHandler, chunk)
+	replies := make([][]byte, chunk)
+
+	for done := 0; done < b.N; done += chunk {
+		n := b.N - done
+		if n > chunk {
+			n = chunk
+		}
+
+		var err error
+		for i := 0; i < n; i++ {
+			if packets[i], handlers[i], err = client.PackOutgoing(message); err != nil {
+				b.Fatalf("Making request packet failed with: %s", err)
+			}
+		}
+
+		b.StopTimer()
+		for i := 0; i < n; i++ {
+			_, serverReplyHandler, _, err := server.UnpackIncoming(packets[i])
+			if err != nil {
+				b.Fatalf("Unpacking request packet failed with: %s", err)
+			}
+			if replies[i], err = serverReplyHandler(message); err != nil {
+				b.Fatalf("Making reply packet failed with: %s", err)
+			}
+		}
+		b.StartTimer()
+
+		for i := 0; i < n; i++ {
+			if _, err = handlers[i](replies[i]); err != nil {
+				b.Fatalf("Unpacking reply packet failed with: %s", err)
+			}
+		}
+	}
 }
 
 func BenchmarkUnpackReplyPacket(b *testing.B) {
@@ -339,40 +399,223 @@ func BenchmarkUnpackReplyPacket(b *testing.B) {
 
 	testMessage := []byte("This is a test!")
 
-	var prebuiltN int
+	// Reusing a pool of replies fails once b.N passes the pool size, since each reply
+	// handler can only be used once, so this times packing the request as well
+	b.ResetTimer()
+	benchmarkPackAndUnpackReply(b, client, server, testMessage)
+}
+
+func TestHeaderEncoding(t *testing.T) {
+	h := header{flagsReply | flagsClientAuth, CipherSuiteX25519AESGCM}
 
-	if b.N > 1000 {
-		prebuiltN = 1000
-	} else {
-		prebuiltN = b.N
+	var b [headerSize]byte
+	h.encode(b[:])
+
+	if !bytes.Equal(b[:], []byte{0xc0, 0x00, 0x00, 0x01}) {
+		t.Errorf("Header encoded to %x", b)
 	}
 
-	prebuilt := make([]prepackedReplies, prebuiltN)
-	for i := 0; i < prebuiltN; i++ {
-		requestPacket, clientReplyHandler, err := client.PackOutgoing(testMessage)
+	decoded, err := decodeHeader(b[:])
+	if err != nil {
+		t.Errorf("Decoding header failed with %s", err)
+	}
+	if decoded != h {
+		t.Errorf("Decoded header did not match")
+	}
+
+	if _, err = decodeHeader(b[:3]); err == nil {
+		t.Errorf("Decoded a truncated header")
+	}
+}
+
+func TestPacketSize(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Errorf("Generate server key failed with %s", err)
+	}
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+
+	testMessage := []byte("This is a test!")
+
+	outgoingPacket, _, err := client.PackOutgoing(testMessage)
+	if err != nil {
+		t.Errorf("Packing request packet failed with %s", err)
+	}
+
+	if len(outgoingPacket) != 4+32+len(testMessage)+16 || cap(outgoingPacket) != len(outgoingPacket) {
+		t.Errorf("Request packet has length %d and capacity %d", len(outgoingPacket), cap(outgoingPacket))
+	}
+
+	receivedMessage, serverReplyHandler, _, err := server.UnpackIncoming(outgoingPacket)
+	if err != nil {
+		t.Errorf("Unpacking request key failed with %s", err)
+	}
+
+	replyPacket, err := serverReplyHandler(receivedMessage)
+	if err != nil {
+		t.Errorf("Packing reply packet failed with %s", err)
+	}
+
+	if len(replyPacket) != 4+32+len(testMessage)+16 || cap(replyPacket) != len(replyPacket) {
+		t.Errorf("Reply packet has length %d and capacity %d", len(replyPacket), cap(replyPacket))
+	}
+}
+
+func TestRoundtripEphemeralPool(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Errorf("Generate server key failed with %s", err)
+	}
+
+	clientPrivateKey, _, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Errorf("Generate client key failed with %s", err)
+	}
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+
+	for _, key := range []interface{}{nil, clientPrivateKey} {
+		client, err := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, key, WithEphemeralPool(4))
 		if err != nil {
-			b.Errorf("Making request packet failed with: %s", err)
+			t.Fatalf("Creating client failed with %s", err)
 		}
-		_, serverReplyhandler, _, err := server.UnpackIncoming(requestPacket)
-		if err != nil {
-			b.Errorf("Unpacking request packet failed with: %s", err)
+
+		testMessage := []byte("This is a test!")
+
+		// Use more keys than the pool holds so that it has to refill
+		for i := 0; i < 10; i++ {
+			outgoingPacket, clientReplyHandler, err := client.PackOutgoing(testMessage)
+			if err != nil {
+				t.Errorf("Packing request packet failed with %s", err)
+			}
+
+			receivedMessage, serverReplyHandler, _, err := server.UnpackIncoming(outgoingPacket)
+			if err != nil {
+				t.Errorf("Unpacking request key failed with %s", err)
+			}
+
+			replyPacket, err := serverReplyHandler(receivedMessage)
+			if err != nil {
+				t.Errorf("Packing reply packet failed with %s", err)
+			}
+
+			receivedReply, err := clientReplyHandler(replyPacket)
+			if err != nil {
+				t.Errorf("Unacking reply packet failed with %s", err)
+			}
+
+			if !bytes.Equal(testMessage, receivedReply) {
+				t.Errorf("Round-trip reply did not match")
+			}
 		}
-		replyPacket, err := serverReplyhandler(testMessage)
-		if err != nil {
-			b.Errorf("Making reply packet failed with: %s", err)
+	}
+}
+
+func TestClientRejectsBadServerKey(t *testing.T) {
+	clientPrivateKey, _, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Errorf("Generate client key failed with %s", err)
+	}
+
+	// A low order point must be rejected when the client is created, not on first use
+	client, err := NewClient(CipherSuiteX25519AESGCM, make([]byte, 32), clientPrivateKey)
+	if err == nil || client != nil {
+		t.Errorf("Client created with a low order server key")
+	}
+}
+
+func TestPackClientAuthLeavesDataUntouched(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Errorf("Generate server key failed with %s", err)
+	}
+
+	clientPrivateKey, _, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Errorf("Generate client key failed with %s", err)
+	}
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, clientPrivateKey)
+
+	testMessage := bytes.Repeat([]byte("This is a test!"), 100)
+	original := append([]byte(nil), testMessage...)
+
+	outgoingPacket, _, err := client.PackOutgoing(testMessage)
+	if err != nil {
+		t.Errorf("Packing request packet failed with %s", err)
+	}
+
+	if !bytes.Equal(testMessage, original) {
+		t.Errorf("Packing modified the caller's data")
+	}
+
+	if len(outgoingPacket) != 4+32+64+len(testMessage)+16 || cap(outgoingPacket) != len(outgoingPacket) {
+		t.Errorf("Request packet has length %d and capacity %d", len(outgoingPacket), cap(outgoingPacket))
+	}
+
+	receivedMessage, _, _, err := server.UnpackIncoming(outgoingPacket)
+	if err != nil {
+		t.Errorf("Unpacking request key failed with %s", err)
+	}
+
+	if !bytes.Equal(testMessage, receivedMessage) {
+		t.Errorf("Received message did not match")
+	}
+}
+
+func TestTruncatedPackets(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Errorf("Generate server key failed with %s", err)
+	}
+
+	clientPrivateKey, _, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Errorf("Generate client key failed with %s", err)
+	}
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, clientPrivateKey)
+
+	outgoingPacket, clientReplyHandler, err := client.PackOutgoing(nil)
+	if err != nil {
+		t.Errorf("Packing request packet failed with %s", err)
+	}
+
+	// Every truncation of a request, including ones that leave the client auth prefix short, must fail cleanly
+	for n := 0; n < len(outgoingPacket); n++ {
+		if _, _, _, err = server.UnpackIncoming(outgoingPacket[:n]); err == nil {
+			t.Errorf("Request truncated to %d bytes unpacked without error", n)
 		}
-		prebuilt[i].replyPacket = replyPacket
-		prebuilt[i].handler = clientReplyHandler
 	}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		packedEntry := prebuilt[i%prebuiltN]
-		packet := packedEntry.replyPacket
-		handler := packedEntry.handler
-		_, err = handler(packet)
-		if err != nil {
-			b.Errorf("Unpacking reply packet failed with: %s", err)
+	for n := 0; n < minPacketSizeX25519AESGCM128; n++ {
+		replyPacket := append([]byte{0xc0, 0x00, 0x00, 0x01}, outgoingPacket[4:]...)
+		if _, err = clientReplyHandler(replyPacket[:n]); err == nil {
+			t.Errorf("Reply truncated to %d bytes unpacked without error", n)
 		}
 	}
 }
+
+func TestClientRandom(t *testing.T) {
+	_, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+
+	seed := bytes.Repeat([]byte{0x42}, 32)
+	packets := make([][]byte, 2)
+	for i := range packets {
+		client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil, WithClientRandom(bytes.NewReader(seed)))
+		if packets[i], _, err = client.PackOutgoing([]byte("This is a test!")); err != nil {
+			t.Fatalf("Packing request packet failed with %s", err)
+		}
+	}
+
+	if !bytes.Equal(packets[0], packets[1]) {
+		t.Errorf("Clients with the same random source packed different packets")
+	}
+}
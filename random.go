@@ -0,0 +1,167 @@
+package gopssst
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"sync"
+)
+
+var defaultRandomSource struct {
+	sync.RWMutex
+	reader io.Reader
+}
+
+/*
+SetRandom replaces the source of randomness used for keys and session secrets wherever
+none is given explicitly, for platforms where crypto/rand is unavailable or not
+trusted. random must be safe for concurrent use; a DRBG is. Passing nil restores
+crypto/rand.
+*/
+func SetRandom(random io.Reader) {
+	defaultRandomSource.Lock()
+	defer defaultRandomSource.Unlock()
+	defaultRandomSource.reader = random
+}
+
+func defaultRandom() io.Reader {
+	defaultRandomSource.RLock()
+	defer defaultRandomSource.RUnlock()
+	if defaultRandomSource.reader == nil {
+		return rand.Reader
+	}
+	return defaultRandomSource.reader
+}
+
+const (
+	drbgSeedSize       = 48
+	drbgMaxRequest     = 1 << 16
+	drbgReseedInterval = 1 << 20
+)
+
+/*
+DRBG is an HMAC_DRBG using SHA-256, as specified in NIST SP 800-90A, for stretching a
+hardware entropy source into a random stream. It reseeds itself from the entropy source
+after a number of requests, and can be reseeded at any time with Reseed. It is safe for
+concurrent use.
+*/
+type DRBG struct {
+	mutex    sync.Mutex
+	entropy  io.Reader
+	key, v   []byte
+	requests int
+	interval int
+}
+
+/*
+NewDRBG instantiates a DRBG, reading 48 bytes of entropy and nonce from entropy, which
+is typically a hardware TRNG. The optional personalization string distinguishes
+instances seeded from the same source.
+*/
+func NewDRBG(entropy io.Reader, personalization []byte) (drbg *DRBG, err error) {
+	seed := make([]byte, drbgSeedSize)
+	if _, err = io.ReadFull(entropy, seed); err != nil {
+		return
+	}
+
+	drbg = &DRBG{entropy: entropy, interval: drbgReseedInterval}
+	drbg.key = make([]byte, sha256.Size)
+	drbg.v = make([]byte, sha256.Size)
+	for i := range drbg.v {
+		drbg.v[i] = 1
+	}
+	drbg.update(seed, personalization)
+	drbg.requests = 1
+
+	return
+}
+
+// SetReseedInterval sets how many reads are served before the DRBG reseeds itself from its entropy source.
+func (drbg *DRBG) SetReseedInterval(requests int) {
+	drbg.mutex.Lock()
+	defer drbg.mutex.Unlock()
+	drbg.interval = requests
+}
+
+/*
+Reseed mixes fresh entropy from the entropy source, and any additional input, into the
+DRBG state. Call it when the platform signals that new entropy is available or after
+events such as a resume from suspend.
+*/
+func (drbg *DRBG) Reseed(additional []byte) error {
+	drbg.mutex.Lock()
+	defer drbg.mutex.Unlock()
+	return drbg.reseed(additional)
+}
+
+func (drbg *DRBG) reseed(additional []byte) (err error) {
+	seed := make([]byte, sha256.Size)
+	if _, err = io.ReadFull(drbg.entropy, seed); err != nil {
+		return
+	}
+	drbg.update(seed, additional)
+	drbg.requests = 1
+	return
+}
+
+// update is the HMAC_DRBG update function, with the provided data given in parts.
+func (drbg *DRBG) update(data ...[]byte) {
+	empty := true
+	for _, d := range data {
+		empty = empty && len(d) == 0
+	}
+
+	for _, round := range []byte{0, 1} {
+		mac := hmac.New(sha256.New, drbg.key)
+		mac.Write(drbg.v)
+		mac.Write([]byte{round})
+		for _, d := range data {
+			mac.Write(d)
+		}
+		drbg.key = mac.Sum(drbg.key[:0])
+
+		mac = hmac.New(sha256.New, drbg.key)
+		mac.Write(drbg.v)
+		drbg.v = mac.Sum(drbg.v[:0])
+
+		if empty {
+			break
+		}
+	}
+}
+
+// Read fills p with random bytes, reseeding first if the reseed interval has passed.
+func (drbg *DRBG) Read(p []byte) (n int, err error) {
+	drbg.mutex.Lock()
+	defer drbg.mutex.Unlock()
+
+	for n < len(p) {
+		if drbg.requests > drbg.interval {
+			if err = drbg.reseed(nil); err != nil {
+				return
+			}
+		}
+
+		request := p[n:]
+		if len(request) > drbgMaxRequest {
+			request = request[:drbgMaxRequest]
+		}
+		drbg.generate(request)
+		n += len(request)
+	}
+
+	return
+}
+
+func (drbg *DRBG) generate(out []byte) {
+	mac := hmac.New(sha256.New, drbg.key)
+	for i := 0; i < len(out); i += sha256.Size {
+		mac.Reset()
+		mac.Write(drbg.v)
+		drbg.v = mac.Sum(drbg.v[:0])
+		copy(out[i:], drbg.v)
+	}
+	drbg.update()
+	drbg.requests++
+}
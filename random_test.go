@@ -0,0 +1,77 @@
+package gopssst
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDRBGVector(t *testing.T) {
+	// From the NIST CAVP HMAC_DRBG tests: SHA-256, no prediction resistance, COUNT = 0
+	entropy, _ := hex.DecodeString("ca851911349384bffe89de1cbdc46e6831e44d34a4fb935ee285dd14b71a7488" +
+		"659ba96c601dc69fc902940805ec0ca8")
+	expected, _ := hex.DecodeString("e528e9abf2dece54d47c7e75e5fe302149f817ea9fb4bee6f4199697d04d5b89" +
+		"d54fbb978a15b5c443c9ec21036d2460b6f73ebad0dc2aba6e624abf07745bc1" +
+		"07694bb7547bb0995f70de25d6b29e2d3011bb19d27676c07162c8b5ccde0668" +
+		"961df86803482cb37ed6d5c0bb8d50cf1f50d476aa0458bdaba806f48be9dcb8")
+
+	drbg, err := NewDRBG(bytes.NewReader(entropy), nil)
+	if err != nil {
+		t.Fatalf("Instantiating DRBG failed with %s", err)
+	}
+
+	out := make([]byte, len(expected))
+	for i := 0; i < 2; i++ {
+		if _, err = drbg.Read(out); err != nil {
+			t.Fatalf("Reading from DRBG failed with %s", err)
+		}
+	}
+	if !bytes.Equal(out, expected) {
+		t.Errorf("DRBG output did not match test vector")
+	}
+}
+
+func TestDRBGReseed(t *testing.T) {
+	entropy := bytes.NewReader(bytes.Repeat([]byte{0x42}, 48+32))
+	drbg, err := NewDRBG(entropy, []byte("device"))
+	if err != nil {
+		t.Fatalf("Instantiating DRBG failed with %s", err)
+	}
+	drbg.SetReseedInterval(1)
+
+	out := make([]byte, 16)
+	for i := 0; i < 2; i++ {
+		if _, err = drbg.Read(out); err != nil {
+			t.Fatalf("Reading from DRBG failed with %s", err)
+		}
+	}
+	if _, err = drbg.Read(out); err == nil {
+		t.Errorf("DRBG served a read after its entropy source was exhausted")
+	}
+}
+
+func TestSetRandom(t *testing.T) {
+	seed := bytes.Repeat([]byte{0x42}, 32)
+	keys := make([][]byte, 2)
+	for i := range keys {
+		SetRandom(bytes.NewReader(seed))
+		privateKey, _, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+		if err != nil {
+			t.Fatalf("Generate key failed with %s", err)
+		}
+		keys[i] = privateKey.([]byte)
+	}
+	SetRandom(nil)
+
+	if !bytes.Equal(keys[0], keys[1]) {
+		t.Errorf("Keys generated from the same default random source differed")
+	}
+
+	privateKey, _, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate key failed with crypto/rand restored: %s", err)
+	}
+	if bytes.Equal(privateKey.([]byte), keys[0]) {
+		t.Errorf("SetRandom(nil) did not restore crypto/rand")
+	}
+}
@@ -0,0 +1,88 @@
+package gopssst
+
+import (
+	"crypto"
+)
+
+/*
+WrapForRelay wraps an already packed request inside a request to a relay, along with the
+address of the next hop that the relay should forward it to. The relay learns the next
+hop but can't read the inner request, and the destination sees only the relay. The
+returned reply handler unwraps the relay's reply and passes the inner reply packet to
+innerReplyHandler, so the caller gets the destination's reply data directly.
+
+Wrapping the result again, for a second relay, gives a two hop route; the route is
+built from the destination outwards.
+*/
+func WrapForRelay(relay Client, nextHop string, innerPacket []byte, innerReplyHandler ReplyHandler) (packetBytes []byte, replyHandler ReplyHandler, err error) {
+	if len(nextHop) > 255 {
+		err = &PSSSTError{"Relay next hop too long"}
+		return
+	}
+
+	payload := make([]byte, 0, 1+len(nextHop)+len(innerPacket))
+	payload = append(payload, byte(len(nextHop)))
+	payload = append(payload, nextHop...)
+	payload = append(payload, innerPacket...)
+
+	var relayReplyHandler ReplyHandler
+	if packetBytes, relayReplyHandler, err = relay.PackOutgoing(payload); err != nil {
+		return
+	}
+
+	replyHandler = func(replyPacketBytes []byte) (data []byte, err error) {
+		var innerReply []byte
+		if innerReply, err = relayReplyHandler(replyPacketBytes); err != nil {
+			return
+		}
+		return innerReplyHandler(innerReply)
+	}
+
+	return
+}
+
+/*
+UnwrapRelay unpacks a request made with WrapForRelay, returning the next hop, the inner
+packet to forward to it and a handler that wraps the inner reply packet as the relay's
+reply. clientPublicKey is the key of the relay's client if it authenticated, which a relay
+can use to decide whom it will forward for.
+*/
+func UnwrapRelay(server Server, packetBytes []byte) (nextHop string, innerPacket []byte, replyHandler ReplyHandler, clientPublicKey crypto.PublicKey, err error) {
+	var payload []byte
+	if payload, replyHandler, clientPublicKey, err = server.UnpackIncoming(packetBytes); err != nil {
+		return
+	}
+
+	if len(payload) < 1 || len(payload) < 1+int(payload[0]) {
+		return "", nil, nil, nil, &PSSSTError{"Relay request truncated"}
+	}
+	nextHop = string(payload[1 : 1+payload[0]])
+	innerPacket = payload[1+payload[0]:]
+
+	return
+}
+
+/*
+Relay handles one relay request: it unwraps the request, passes the inner packet to
+forward along with the next hop and the relay client's public key, and wraps the inner
+reply that forward returns. forward typically sends the inner packet to the next hop
+over UDP and returns the reply packet that comes back.
+
+The next hop is chosen by the client, so forward must enforce the relay's policy on
+which clients may reach which next hops, returning an error for anything else.
+Otherwise the relay is open to anyone who knows its public key and can be used to reach
+hosts behind it. clientPublicKey is nil if the client did not authenticate.
+*/
+func Relay(server Server, packetBytes []byte, forward func(nextHop string, innerPacket []byte, clientPublicKey crypto.PublicKey) (innerReply []byte, err error)) (reply []byte, err error) {
+	nextHop, innerPacket, replyHandler, clientPublicKey, err := UnwrapRelay(server, packetBytes)
+	if err != nil {
+		return
+	}
+
+	var innerReply []byte
+	if innerReply, err = forward(nextHop, innerPacket, clientPublicKey); err != nil {
+		return
+	}
+
+	return replyHandler(innerReply)
+}
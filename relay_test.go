@@ -0,0 +1,132 @@
+package gopssst
+
+import (
+	"bytes"
+	"crypto"
+	"testing"
+)
+
+// relayHop is a server at a named address, as seen by a test's forward function.
+type relayHop struct {
+	server    Server
+	publicKey []byte
+}
+
+func newRelayHop(t *testing.T) relayHop {
+	privateKey, publicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate key failed with %s", err)
+	}
+	server, err := NewServer(CipherSuiteX25519AESGCM, privateKey)
+	if err != nil {
+		t.Fatalf("Creating server failed with %s", err)
+	}
+	return relayHop{server, publicKey.([]byte)}
+}
+
+func TestRelayTwoHops(t *testing.T) {
+	hops := map[string]relayHop{
+		"relay1:4242": newRelayHop(t),
+		"relay2:4242": newRelayHop(t),
+		"dest:4242":   newRelayHop(t),
+	}
+	clientFor := func(address string) Client {
+		client, err := NewClient(CipherSuiteX25519AESGCM, hops[address].publicKey, nil)
+		if err != nil {
+			t.Fatalf("Creating client failed with %s", err)
+		}
+		return client
+	}
+
+	var forwarded []string
+	var forward func(nextHop string, innerPacket []byte, clientPublicKey crypto.PublicKey) ([]byte, error)
+	forward = func(nextHop string, innerPacket []byte, clientPublicKey crypto.PublicKey) ([]byte, error) {
+		forwarded = append(forwarded, nextHop)
+		if nextHop != "dest:4242" {
+			return Relay(hops[nextHop].server, innerPacket, forward)
+		}
+
+		data, replyHandler, _, err := hops[nextHop].server.UnpackIncoming(innerPacket)
+		if err != nil {
+			return nil, err
+		}
+		return replyHandler(append([]byte("Re: "), data...))
+	}
+
+	// Build the route from the destination outwards
+	packet, replyHandler, err := clientFor("dest:4242").PackOutgoing([]byte("Hello"))
+	if err != nil {
+		t.Fatalf("Packing request failed with %s", err)
+	}
+	if packet, replyHandler, err = WrapForRelay(clientFor("relay2:4242"), "dest:4242", packet, replyHandler); err != nil {
+		t.Fatalf("Wrapping for relay 2 failed with %s", err)
+	}
+	if packet, replyHandler, err = WrapForRelay(clientFor("relay1:4242"), "relay2:4242", packet, replyHandler); err != nil {
+		t.Fatalf("Wrapping for relay 1 failed with %s", err)
+	}
+
+	reply, err := forward("relay1:4242", packet, nil)
+	if err != nil {
+		t.Fatalf("Relaying failed with %s", err)
+	}
+	data, err := replyHandler(reply)
+	if err != nil {
+		t.Fatalf("Unpacking relayed reply failed with %s", err)
+	}
+	if !bytes.Equal(data, []byte("Re: Hello")) {
+		t.Errorf("Relayed reply did not match")
+	}
+	if len(forwarded) != 3 || forwarded[1] != "relay2:4242" || forwarded[2] != "dest:4242" {
+		t.Errorf("Packet took the wrong route: %v", forwarded)
+	}
+}
+
+func TestUnwrapRelayRejects(t *testing.T) {
+	relay := newRelayHop(t)
+	client, _ := NewClient(CipherSuiteX25519AESGCM, relay.publicKey, nil)
+
+	if _, _, err := WrapForRelay(client, string(make([]byte, 256)), nil, nil); err == nil {
+		t.Errorf("Next hop over 255 bytes accepted")
+	}
+
+	// A plain request whose first byte claims a longer next hop than there is data
+	packet, _, _ := client.PackOutgoing([]byte{10, 'x'})
+	if _, _, _, _, err := UnwrapRelay(relay.server, packet); err == nil {
+		t.Errorf("Truncated relay request accepted")
+	}
+}
+
+func TestRelayPolicy(t *testing.T) {
+	relay := newRelayHop(t)
+	clientPrivateKey, clientPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate client key failed with %s", err)
+	}
+
+	// Only the authenticated client may use the relay
+	forward := func(nextHop string, innerPacket []byte, seenKey crypto.PublicKey) ([]byte, error) {
+		if key, _ := seenKey.([]byte); !bytes.Equal(key, clientPublicKey.([]byte)) {
+			return nil, &PSSSTError{"Relay not permitted"}
+		}
+		return innerPacket, nil
+	}
+
+	for _, privateKey := range []interface{}{nil, clientPrivateKey} {
+		client, err := NewClient(CipherSuiteX25519AESGCM, relay.publicKey, privateKey)
+		if err != nil {
+			t.Fatalf("Creating client failed with %s", err)
+		}
+		packet, _, err := WrapForRelay(client, "internal:22", []byte("Hello"), nil)
+		if err != nil {
+			t.Fatalf("Wrapping for relay failed with %s", err)
+		}
+
+		_, err = Relay(relay.server, packet, forward)
+		if privateKey == nil && err == nil {
+			t.Errorf("Anonymous client was relayed")
+		}
+		if privateKey != nil && err != nil {
+			t.Errorf("Authenticated client was not relayed: %s", err)
+		}
+	}
+}
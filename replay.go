@@ -0,0 +1,110 @@
+package gopssst
+
+import (
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+const replayCacheShards = 64
+
+type replayCacheShard struct {
+	mutex    sync.Mutex
+	rotated  time.Time
+	current  map[[32]byte]struct{}
+	previous map[[32]byte]struct{}
+}
+
+/*
+ReplayCache detects replayed requests by remembering the DH param of every request
+seen within a time window. It is split into independently locked shards, each holding
+two generations of entries that are rotated at each multiple of the window, so checks
+from many goroutines rarely contend and expiry needs no background sweeping.
+*/
+type ReplayCache struct {
+	window     time.Duration
+	shardLimit int
+	seed       maphash.Seed
+	shards     [replayCacheShards]replayCacheShard
+	now        func() time.Time
+}
+
+/*
+NewReplayCache returns a cache that remembers each request for at least window and at
+most twice window, holding at most about maxEntries requests. Servers using it should
+reject requests older than window by other means, for instance a timestamp in the
+request data. While the cache is full new requests are reported as replays, since they
+can't be remembered, so maxEntries should allow for twice window of peak traffic. The
+window must be positive.
+*/
+func NewReplayCache(window time.Duration, maxEntries int) (cache *ReplayCache, err error) {
+	if window <= 0 {
+		err = &PSSSTError{"Replay window must be positive"}
+		return
+	}
+
+	shardLimit := maxEntries / replayCacheShards
+	if shardLimit < 1 {
+		shardLimit = 1
+	}
+
+	cache = &ReplayCache{window: window, shardLimit: shardLimit, seed: maphash.MakeSeed(), now: time.Now}
+	for i := range cache.shards {
+		cache.shards[i].current = make(map[[32]byte]struct{})
+	}
+
+	return
+}
+
+/*
+Check records the request and returns true if it has not been seen before, or false if
+it is a replay. Packets too short to hold a DH param are reported as replays. Only call
+Check on a request after UnpackIncoming has accepted it, so that forged packets can't
+fill the cache.
+*/
+func (cache *ReplayCache) Check(requestPacket []byte) bool {
+	if len(requestPacket) < 36 {
+		return false
+	}
+
+	var key [32]byte
+	copy(key[:], requestPacket[4:36])
+
+	var h maphash.Hash
+	h.SetSeed(cache.seed)
+	h.Write(key[:])
+	shard := &cache.shards[h.Sum64()%replayCacheShards]
+
+	now := cache.now()
+
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	// Each shard's windows start at its first check
+	if shard.rotated.IsZero() {
+		shard.rotated = now
+	}
+	// Rotating on window boundaries rather than when checked bounds an entry's lifetime
+	if periods := now.Sub(shard.rotated) / cache.window; periods > 0 {
+		if periods > 1 {
+			shard.previous = nil
+		} else {
+			shard.previous = shard.current
+		}
+		shard.current = make(map[[32]byte]struct{}, len(shard.current))
+		shard.rotated = shard.rotated.Add(periods * cache.window)
+	}
+
+	if _, ok := shard.current[key]; ok {
+		return false
+	}
+	if _, ok := shard.previous[key]; ok {
+		return false
+	}
+	if len(shard.current)+len(shard.previous) >= cache.shardLimit {
+		return false
+	}
+	shard.current[key] = struct{}{}
+
+	return true
+}
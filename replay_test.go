@@ -0,0 +1,132 @@
+package gopssst
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestReplayCache(t *testing.T) {
+	_, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+
+	now := time.Now()
+	cache, err := NewReplayCache(time.Minute, 1000)
+	if err != nil {
+		t.Fatalf("Creating replay cache failed with %s", err)
+	}
+	cache.now = func() time.Time { return now }
+
+	packet, _, err := client.PackOutgoing([]byte("This is a test!"))
+	if err != nil {
+		t.Fatalf("Packing request packet failed with %s", err)
+	}
+
+	if !cache.Check(packet) {
+		t.Errorf("New request reported as a replay")
+	}
+	if cache.Check(packet) {
+		t.Errorf("Replayed request not detected")
+	}
+
+	otherPacket, _, err := client.PackOutgoing([]byte("This is a test!"))
+	if err != nil {
+		t.Fatalf("Packing request packet failed with %s", err)
+	}
+	if !cache.Check(otherPacket) {
+		t.Errorf("Distinct request reported as a replay")
+	}
+
+	if cache.Check(packet[:20]) {
+		t.Errorf("Short packet accepted")
+	}
+
+	// Entries are remembered for at least one window and forgotten after at most two
+	now = now.Add(time.Minute - time.Millisecond)
+	if cache.Check(otherPacket) {
+		t.Errorf("Request forgotten within the window")
+	}
+	now = now.Add(time.Minute + time.Millisecond)
+	if !cache.Check(packet) {
+		t.Errorf("Request still remembered after two windows")
+	}
+}
+
+func TestReplayCacheLifetime(t *testing.T) {
+	now := time.Now()
+	cache, err := NewReplayCache(time.Minute, 1000)
+	if err != nil {
+		t.Fatalf("Creating replay cache failed with %s", err)
+	}
+	cache.now = func() time.Time { return now }
+
+	for i := range cache.shards {
+		cache.shards[i].rotated = now
+	}
+
+	// A replay checked late in a window must not keep the entry alive past two windows
+	packet := make([]byte, 36)
+	now = now.Add(time.Second)
+	if !cache.Check(packet) {
+		t.Errorf("New request reported as a replay")
+	}
+	now = now.Add(2*time.Minute - 2*time.Second)
+	if cache.Check(packet) {
+		t.Errorf("Request forgotten within two windows")
+	}
+	now = now.Add(time.Minute)
+	if !cache.Check(packet) {
+		t.Errorf("Request still remembered after three windows")
+	}
+}
+
+func TestReplayCacheLimit(t *testing.T) {
+	cache, err := NewReplayCache(time.Minute, 0)
+	if err != nil {
+		t.Fatalf("Creating replay cache failed with %s", err)
+	}
+
+	// With a limit of one entry per shard, some pair of distinct requests must share a full shard
+	packet := make([]byte, 36)
+	rejected := false
+	for i := 0; i <= replayCacheShards; i++ {
+		binary.BigEndian.PutUint64(packet[28:36], uint64(i))
+		if !cache.Check(packet) {
+			rejected = true
+		}
+	}
+	if !rejected {
+		t.Errorf("Cache accepted more requests than its limit")
+	}
+}
+
+func BenchmarkReplayCacheParallel(b *testing.B) {
+	cache, err := NewReplayCache(time.Minute, 1<<30)
+	if err != nil {
+		b.Fatalf("Creating replay cache failed with %s", err)
+	}
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		// Each goroutine uses a random prefix and a counter so that keys are distinct
+		packet := make([]byte, 36)
+		rand.Read(packet[4:28])
+		for i := uint64(0); pb.Next(); i++ {
+			binary.BigEndian.PutUint64(packet[28:36], i)
+			cache.Check(packet)
+		}
+	})
+}
+
+func TestReplayCacheRejectsBadWindow(t *testing.T) {
+	for _, window := range []time.Duration{0, -time.Second} {
+		if _, err := NewReplayCache(window, 1000); err == nil {
+			t.Errorf("Replay cache with window %s was created", window)
+		}
+	}
+}
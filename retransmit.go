@@ -0,0 +1,176 @@
+package gopssst
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"net"
+	"sync"
+	"time"
+)
+
+// exchangeMaxPacketSize is the largest reply datagram Exchange will read.
+const exchangeMaxPacketSize = 65536
+
+/*
+Exchange packs data as a request, sends it on conn and waits for the matching reply,
+retransmitting the same request packet each time timeout expires without a reply,
+up to attempts times in total, which must be at least one. Because every
+retransmission is byte-for-byte identical, a server using a ReplyCache answers it from
+the cache rather than handling it again.
+Datagrams on conn that are not a reply to this request are ignored, as are replies that
+fail to open, so a forged reply can't abort the exchange.
+*/
+func Exchange(conn net.Conn, client Client, data []byte, timeout time.Duration, attempts int) (reply []byte, err error) {
+	if attempts <= 0 {
+		err = &PSSSTError{"Exchange needs at least one attempt"}
+		return
+	}
+
+	packetBytes, replyHandler, err := client.PackOutgoing(data)
+	if err != nil {
+		return
+	}
+	dhParam := packetBytes[4:36]
+
+	buf := make([]byte, exchangeMaxPacketSize)
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		if _, err = conn.Write(packetBytes); err != nil {
+			return
+		}
+		if err = conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return
+		}
+
+		for {
+			var n int
+			n, err = conn.Read(buf)
+			if err != nil {
+				break
+			}
+			if n < 36 || !bytes.Equal(buf[4:36], dhParam) {
+				continue
+			}
+			// The reply handler is only used up by a reply that opens successfully
+			if reply, err = replyHandler(buf[:n]); err == nil {
+				return
+			}
+		}
+
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			return
+		}
+	}
+
+	err = &PSSSTError{"No reply received"}
+	return
+}
+
+type replyCacheEntry struct {
+	reply   []byte
+	done    bool
+	expires time.Time
+}
+
+/*
+ReplyCache remembers the replies sent for recent requests, keyed by a hash of the whole
+request packet, so that retransmitted duplicates are answered without unpacking the
+request or invoking the handler again. Only a byte-for-byte identical retransmission gets
+the cached reply; a spoofed packet reusing a request's DH parameter is handled, and
+rejected, like any other. This makes it safe to use Exchange for
+non-idempotent operations on lossy links. Duplicates are answered before any X25519
+work is done, so there is no need to keep the derived keys of past requests around.
+*/
+type ReplyCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mutex   sync.Mutex
+	entries map[string]*replyCacheEntry
+	order   []string
+}
+
+/*
+NewReplyCache returns a cache that keeps each reply for ttl, holding at most
+maxEntries replies. The ttl should exceed the longest time a client will keep
+retransmitting a request.
+*/
+func NewReplyCache(ttl time.Duration, maxEntries int) *ReplyCache {
+	return &ReplyCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*replyCacheEntry),
+	}
+}
+
+/*
+Handle returns the reply to requestPacket. The first time a request is seen handle is
+called to produce the reply, which is then cached; later duplicates get the cached reply.
+If a duplicate arrives while the first copy is still being handled Handle returns a nil
+reply and nil error and the duplicate should be dropped. If handle fails nothing is
+cached, so a retransmission will be handled afresh.
+*/
+func (c *ReplyCache) Handle(requestPacket []byte, handle func(requestPacket []byte) ([]byte, error)) (reply []byte, err error) {
+	if len(requestPacket) < 36 {
+		err = &PSSSTError{"Packet too short"}
+		return
+	}
+	hash := sha256.Sum256(requestPacket)
+	key := string(hash[:])
+
+	c.mutex.Lock()
+	c.expire(time.Now())
+	if entry, ok := c.entries[key]; ok {
+		c.mutex.Unlock()
+		if !entry.done {
+			return nil, nil
+		}
+		return entry.reply, nil
+	}
+	entry := &replyCacheEntry{expires: time.Now().Add(c.ttl)}
+	c.entries[key] = entry
+	c.order = append(c.order, key)
+	c.mutex.Unlock()
+
+	reply, err = handle(requestPacket)
+
+	c.mutex.Lock()
+	if err != nil {
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+			c.removeOrder(key)
+		}
+	} else {
+		entry.reply = reply
+		entry.done = true
+	}
+	c.mutex.Unlock()
+
+	return
+}
+
+// removeOrder removes key from the eviction order. The caller must hold the mutex.
+func (c *ReplyCache) removeOrder(key string) {
+	for i := len(c.order) - 1; i >= 0; i-- {
+		if c.order[i] == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			return
+		}
+	}
+}
+
+// expire drops expired entries and the oldest entries beyond maxEntries. The caller must hold the mutex.
+func (c *ReplyCache) expire(now time.Time) {
+	dropped := 0
+	for _, key := range c.order {
+		entry, ok := c.entries[key]
+		if ok && now.Before(entry.expires) && len(c.order)-dropped < c.maxEntries {
+			break
+		}
+		if ok {
+			delete(c.entries, key)
+		}
+		dropped++
+	}
+	c.order = c.order[dropped:]
+}
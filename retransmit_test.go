@@ -0,0 +1,222 @@
+package gopssst
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExchangeRetransmit(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+
+	packetSocket, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed with %s", err)
+	}
+	defer packetSocket.Close()
+
+	cache := NewReplyCache(time.Minute, 100)
+	var handled int32
+
+	go func() {
+		buf := make([]byte, 2048)
+		for received := 0; ; received++ {
+			n, addr, err := packetSocket.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			reply, err := cache.Handle(buf[:n], func(requestPacket []byte) ([]byte, error) {
+				atomic.AddInt32(&handled, 1)
+				data, replyHandler, _, err := server.UnpackIncoming(requestPacket)
+				if err != nil {
+					return nil, err
+				}
+				return replyHandler(data)
+			})
+			// Lose the first reply so that the client has to retransmit
+			if err != nil || reply == nil || received == 0 {
+				continue
+			}
+			packetSocket.WriteTo(reply, addr)
+		}
+	}()
+
+	conn, err := net.Dial("udp", packetSocket.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial failed with %s", err)
+	}
+	defer conn.Close()
+
+	testMessage := []byte("This is a test!")
+
+	receivedReply, err := Exchange(conn, client, testMessage, 50*time.Millisecond, 5)
+	if err != nil {
+		t.Fatalf("Exchange failed with %s", err)
+	}
+
+	if !bytes.Equal(testMessage, receivedReply) {
+		t.Errorf("Round-trip reply did not match")
+	}
+
+	if n := atomic.LoadInt32(&handled); n != 1 {
+		t.Errorf("Request was handled %d times", n)
+	}
+}
+
+func TestReplyCacheExpiry(t *testing.T) {
+	cache := NewReplyCache(time.Minute, 2)
+	handled := 0
+	handle := func(requestPacket []byte) ([]byte, error) {
+		handled++
+		return requestPacket[4:5], nil
+	}
+
+	packets := make([][]byte, 3)
+	for i := range packets {
+		packets[i] = make([]byte, 36)
+		packets[i][4] = byte(i)
+		cache.Handle(packets[i], handle)
+	}
+
+	// The oldest entry should have been evicted to keep within the size limit
+	cache.Handle(packets[2], handle)
+	cache.Handle(packets[0], handle)
+
+	if handled != 4 {
+		t.Errorf("Expected 4 calls to the handler, got %d", handled)
+	}
+}
+
+func TestReplyCacheOnlyAnswersIdenticalRequests(t *testing.T) {
+	cache := NewReplyCache(time.Minute, 10)
+	handled := 0
+	handle := func(requestPacket []byte) ([]byte, error) {
+		handled++
+		if len(requestPacket) != 100 {
+			return nil, &PSSSTError{"Not a valid request"}
+		}
+		return make([]byte, 1000), nil
+	}
+
+	request := make([]byte, 100)
+	if reply, err := cache.Handle(request, handle); err != nil || len(reply) != 1000 {
+		t.Fatalf("Request was not handled")
+	}
+
+	// A short packet sharing the DH param must not be answered from the cache
+	if reply, err := cache.Handle(request[:36], handle); err == nil || reply != nil {
+		t.Errorf("Spoofed packet with a cached DH param got the cached reply")
+	}
+	if reply, err := cache.Handle(request, handle); err != nil || len(reply) != 1000 {
+		t.Errorf("Retransmission was not answered from the cache")
+	}
+	if handled != 2 {
+		t.Errorf("Expected 2 calls to the handler, got %d", handled)
+	}
+}
+
+func TestReplyCacheFailedRequestOrder(t *testing.T) {
+	cache := NewReplyCache(time.Minute, 10)
+	fail := func(requestPacket []byte) ([]byte, error) {
+		return nil, &PSSSTError{"Failed"}
+	}
+	succeed := func(requestPacket []byte) ([]byte, error) {
+		return []byte("OK"), nil
+	}
+
+	request := make([]byte, 36)
+	cache.Handle(request, fail)
+	cache.Handle(request, succeed)
+
+	if len(cache.order) != 1 {
+		t.Errorf("Eviction order holds %d keys for one entry", len(cache.order))
+	}
+}
+
+func TestExchangeIgnoresForgedReply(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+	server, err := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	if err != nil {
+		t.Fatalf("Creating server failed with %s", err)
+	}
+	client, err := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+	if err != nil {
+		t.Fatalf("Creating client failed with %s", err)
+	}
+
+	packetSocket, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed with %s", err)
+	}
+	defer packetSocket.Close()
+
+	go func() {
+		buf := make([]byte, 2048)
+		n, addr, err := packetSocket.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		data, replyHandler, _, err := server.UnpackIncoming(buf[:n])
+		if err != nil {
+			return
+		}
+		reply, _ := replyHandler(data)
+
+		// Send a forged reply with the right DH param before the real one
+		forged := append([]byte{}, reply...)
+		forged[len(forged)-1] ^= 1
+		packetSocket.WriteTo(forged, addr)
+		packetSocket.WriteTo(reply, addr)
+	}()
+
+	conn, err := net.Dial("udp", packetSocket.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial failed with %s", err)
+	}
+	defer conn.Close()
+
+	reply, err := Exchange(conn, client, []byte("This is a test!"), time.Second, 1)
+	if err != nil {
+		t.Fatalf("Exchange failed with %s", err)
+	}
+	if !bytes.Equal(reply, []byte("This is a test!")) {
+		t.Errorf("Reply did not match")
+	}
+}
+
+func TestExchangeRejectsNoAttempts(t *testing.T) {
+	_, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+
+	packetSocket, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed with %s", err)
+	}
+	defer packetSocket.Close()
+
+	conn, err := net.Dial("udp", packetSocket.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial failed with %s", err)
+	}
+	defer conn.Close()
+
+	for _, attempts := range []int{0, -1} {
+		if reply, err := Exchange(conn, client, []byte("test"), 50*time.Millisecond, attempts); err == nil {
+			t.Errorf("Exchange with %d attempts succeeded with reply %q", attempts, reply)
+		}
+	}
+}
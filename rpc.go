@@ -0,0 +1,332 @@
+package gopssst
+
+import (
+	"encoding/json"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+// rpcMaxPacketSize is the largest UDP datagram the RPC codecs will read.
+const rpcMaxPacketSize = 65536
+
+// The RPC codecs carry JSON-RPC 1.0 style messages, one per PSSST request or reply.
+
+type rpcRequest struct {
+	Method string           `json:"method"`
+	Params *json.RawMessage `json:"params"`
+	Id     uint64           `json:"id"`
+}
+
+type rpcClientResponse struct {
+	Id     uint64           `json:"id"`
+	Result *json.RawMessage `json:"result"`
+	Error  interface{}      `json:"error"`
+}
+
+type rpcServerResponse struct {
+	Id     uint64      `json:"id"`
+	Result interface{} `json:"result"`
+	Error  interface{} `json:"error"`
+}
+
+type rpcPendingCall struct {
+	seq          uint64
+	replyHandler ReplyHandler
+	deadline     time.Time
+}
+
+type rpcClientCodec struct {
+	client   Client
+	conn     net.Conn
+	timeout  time.Duration
+	buf      []byte
+	response rpcClientResponse
+
+	mutex        sync.Mutex
+	pending      map[string]rpcPendingCall
+	readDeadline time.Time
+}
+
+/*
+NewRPCClientCodec returns an rpc.ClientCodec that sends each call as a single PSSST
+request over conn, which would normally be a connected UDP socket. Replies are matched
+to calls by their DH parameter so they may arrive in any order, and packets that fail
+to open as a reply are ignored. Since datagrams can be lost, a call with no reply after
+timeout fails with an error and is forgotten, so Call never waits forever. timeout must
+be positive.
+*/
+func NewRPCClientCodec(client Client, conn net.Conn, timeout time.Duration) (codec rpc.ClientCodec, err error) {
+	if timeout <= 0 {
+		err = &PSSSTError{"RPC timeout must be positive"}
+		return
+	}
+
+	codec = &rpcClientCodec{
+		client:  client,
+		conn:    conn,
+		timeout: timeout,
+		buf:     make([]byte, rpcMaxPacketSize),
+		pending: make(map[string]rpcPendingCall),
+	}
+	return
+}
+
+/*
+DialRPC connects to a PSSST RPC server at address on the given datagram network and
+returns an rpc.Client that uses client to protect each call, failing calls that get no
+reply within timeout.
+*/
+func DialRPC(network, address string, client Client, timeout time.Duration) (*rpc.Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := NewRPCClientCodec(client, conn, timeout)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return rpc.NewClientWithCodec(codec), nil
+}
+
+func (c *rpcClientCodec) WriteRequest(r *rpc.Request, param interface{}) (err error) {
+	var params []byte
+	if params, err = json.Marshal([1]interface{}{param}); err != nil {
+		return
+	}
+	rawParams := json.RawMessage(params)
+
+	var message []byte
+	if message, err = json.Marshal(&rpcRequest{r.ServiceMethod, &rawParams, r.Seq}); err != nil {
+		return
+	}
+
+	packetBytes, replyHandler, err := c.client.PackOutgoing(message)
+	if err != nil {
+		return
+	}
+
+	key := string(packetBytes[4:36])
+	deadline := time.Now().Add(c.timeout)
+
+	c.mutex.Lock()
+	c.pending[key] = rpcPendingCall{r.Seq, replyHandler, deadline}
+	// Wake the reader in time to expire this call if nothing else does
+	if c.readDeadline.IsZero() || deadline.Before(c.readDeadline) {
+		c.readDeadline = deadline
+		err = c.conn.SetReadDeadline(deadline)
+	}
+	c.mutex.Unlock()
+
+	if err == nil {
+		_, err = c.conn.Write(packetBytes)
+	}
+	if err != nil {
+		c.mutex.Lock()
+		delete(c.pending, key)
+		c.mutex.Unlock()
+	}
+	return
+}
+
+/*
+expire removes a call whose deadline has passed, returning its sequence number, and
+otherwise sets the read deadline to the earliest deadline of the pending calls.
+*/
+func (c *rpcClientCodec) expire() (seq uint64, expired bool, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	c.readDeadline = time.Time{}
+	for key, call := range c.pending {
+		if !now.Before(call.deadline) {
+			delete(c.pending, key)
+			return call.seq, true, nil
+		}
+		if c.readDeadline.IsZero() || call.deadline.Before(c.readDeadline) {
+			c.readDeadline = call.deadline
+		}
+	}
+	err = c.conn.SetReadDeadline(c.readDeadline)
+	return
+}
+
+func (c *rpcClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	for {
+		seq, expired, err := c.expire()
+		if err != nil {
+			return err
+		}
+		if expired {
+			r.Seq = seq
+			r.Error = (&PSSSTError{"RPC call timed out"}).Error()
+			c.response = rpcClientResponse{}
+			return nil
+		}
+
+		n, err := c.conn.Read(c.buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		if n < 36 {
+			continue
+		}
+
+		key := string(c.buf[4:36])
+		c.mutex.Lock()
+		call, ok := c.pending[key]
+		c.mutex.Unlock()
+		if !ok {
+			continue
+		}
+
+		// A packet that fails to open leaves the call waiting for the real reply
+		data, err := call.replyHandler(c.buf[:n])
+		if err != nil {
+			continue
+		}
+
+		c.mutex.Lock()
+		delete(c.pending, key)
+		c.mutex.Unlock()
+
+		r.Seq = call.seq
+		c.response = rpcClientResponse{}
+
+		if err = json.Unmarshal(data, &c.response); err != nil {
+			r.Error = err.Error()
+			return nil
+		}
+
+		if c.response.Error != nil {
+			msg, ok := c.response.Error.(string)
+			if !ok || msg == "" {
+				msg = "unspecified error"
+			}
+			r.Error = msg
+		}
+		return nil
+	}
+}
+
+func (c *rpcClientCodec) ReadResponseBody(x interface{}) error {
+	if x == nil || c.response.Result == nil {
+		return nil
+	}
+	return json.Unmarshal(*c.response.Result, x)
+}
+
+func (c *rpcClientCodec) Close() error {
+	return c.conn.Close()
+}
+
+type rpcPendingReply struct {
+	id           uint64
+	replyHandler ReplyHandler
+	addr         net.Addr
+}
+
+type rpcServerCodec struct {
+	server  Server
+	conn    net.PacketConn
+	buf     []byte
+	request rpcRequest
+
+	mutex   sync.Mutex
+	seq     uint64
+	pending map[uint64]rpcPendingReply
+}
+
+/*
+NewRPCServerCodec returns an rpc.ServerCodec that reads PSSST requests from conn and
+sends each response back to the address the request came from. Packets that fail to
+unpack are silently dropped.
+*/
+func NewRPCServerCodec(server Server, conn net.PacketConn) rpc.ServerCodec {
+	return &rpcServerCodec{
+		server:  server,
+		conn:    conn,
+		buf:     make([]byte, rpcMaxPacketSize),
+		pending: make(map[uint64]rpcPendingReply),
+	}
+}
+
+func (c *rpcServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	for {
+		n, addr, err := c.conn.ReadFrom(c.buf)
+		if err != nil {
+			return err
+		}
+
+		data, replyHandler, _, err := c.server.UnpackIncoming(c.buf[:n])
+		if err != nil {
+			continue
+		}
+
+		c.request = rpcRequest{}
+		if err = json.Unmarshal(data, &c.request); err != nil {
+			continue
+		}
+
+		r.ServiceMethod = c.request.Method
+
+		c.mutex.Lock()
+		c.seq++
+		c.pending[c.seq] = rpcPendingReply{c.request.Id, replyHandler, addr}
+		r.Seq = c.seq
+		c.mutex.Unlock()
+
+		return nil
+	}
+}
+
+func (c *rpcServerCodec) ReadRequestBody(x interface{}) error {
+	if x == nil {
+		return nil
+	}
+	if c.request.Params == nil {
+		return &PSSSTError{"RPC request has no parameters"}
+	}
+	params := [1]interface{}{x}
+	return json.Unmarshal(*c.request.Params, &params)
+}
+
+func (c *rpcServerCodec) WriteResponse(r *rpc.Response, x interface{}) (err error) {
+	c.mutex.Lock()
+	pending, ok := c.pending[r.Seq]
+	delete(c.pending, r.Seq)
+	c.mutex.Unlock()
+	if !ok {
+		return &PSSSTError{"Invalid RPC sequence number in response"}
+	}
+
+	response := rpcServerResponse{Id: pending.id}
+	if r.Error == "" {
+		response.Result = x
+	} else {
+		response.Error = r.Error
+	}
+
+	var message []byte
+	if message, err = json.Marshal(&response); err != nil {
+		return
+	}
+
+	reply, err := pending.replyHandler(message)
+	if err != nil {
+		return
+	}
+
+	_, err = c.conn.WriteTo(reply, pending.addr)
+	return
+}
+
+func (c *rpcServerCodec) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,301 @@
+package gopssst
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"sync"
+	"testing"
+	"time"
+)
+
+type RPCTestArgs struct {
+	A, B int
+}
+
+type RPCTestArith int
+
+func (t *RPCTestArith) Multiply(args *RPCTestArgs, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+// RPCTestBarrier holds every call until all the expected calls have arrived.
+type RPCTestBarrier struct {
+	arrived sync.WaitGroup
+}
+
+func (b *RPCTestBarrier) Multiply(args *RPCTestArgs, reply *int) error {
+	b.arrived.Done()
+	b.arrived.Wait()
+	*reply = args.A * args.B
+	return nil
+}
+
+func TestRPCRoundtrip(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+
+	server, _ := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	client, _ := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+
+	packetSocket, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed with %s", err)
+	}
+
+	rpcServer := rpc.NewServer()
+	if err = rpcServer.Register(new(RPCTestArith)); err != nil {
+		t.Fatalf("Registering RPC service failed with %s", err)
+	}
+	go rpcServer.ServeCodec(NewRPCServerCodec(server, packetSocket))
+	defer packetSocket.Close()
+
+	rpcClient, err := DialRPC("udp", packetSocket.LocalAddr().String(), client, time.Second)
+	if err != nil {
+		t.Fatalf("Dialing RPC server failed with %s", err)
+	}
+	defer rpcClient.Close()
+
+	var product int
+	if err = rpcClient.Call("RPCTestArith.Multiply", &RPCTestArgs{7, 6}, &product); err != nil {
+		t.Fatalf("RPC call failed with %s", err)
+	}
+	if product != 42 {
+		t.Errorf("RPC call returned %d", product)
+	}
+
+	err = rpcClient.Call("RPCTestArith.Divide", &RPCTestArgs{7, 6}, &product)
+	if err == nil {
+		t.Errorf("RPC call to unknown method succeeded")
+	}
+}
+
+func pendingRPCCalls(codec rpc.ClientCodec) int {
+	c := codec.(*rpcClientCodec)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.pending)
+}
+
+func TestRPCLostReply(t *testing.T) {
+	_, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+	client, err := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+	if err != nil {
+		t.Fatalf("Creating client failed with %s", err)
+	}
+
+	// A server that never answers
+	packetSocket, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed with %s", err)
+	}
+	defer packetSocket.Close()
+
+	conn, err := net.Dial("udp", packetSocket.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial failed with %s", err)
+	}
+	codec, err := NewRPCClientCodec(client, conn, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Creating codec failed with %s", err)
+	}
+	rpcClient := rpc.NewClientWithCodec(codec)
+	defer rpcClient.Close()
+
+	var product int
+	if err = rpcClient.Call("RPCTestArith.Multiply", &RPCTestArgs{7, 6}, &product); err == nil {
+		t.Errorf("RPC call with no reply succeeded")
+	}
+	if n := pendingRPCCalls(codec); n != 0 {
+		t.Errorf("%d calls still pending after timing out", n)
+	}
+}
+
+type rpcFailingConn struct {
+	net.Conn
+}
+
+func (c rpcFailingConn) Write(b []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestRPCWriteFailure(t *testing.T) {
+	_, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+	client, err := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+	if err != nil {
+		t.Fatalf("Creating client failed with %s", err)
+	}
+
+	packetSocket, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed with %s", err)
+	}
+	defer packetSocket.Close()
+
+	conn, err := net.Dial("udp", packetSocket.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial failed with %s", err)
+	}
+	codec, err := NewRPCClientCodec(client, rpcFailingConn{conn}, time.Minute)
+	if err != nil {
+		t.Fatalf("Creating codec failed with %s", err)
+	}
+	rpcClient := rpc.NewClientWithCodec(codec)
+	defer rpcClient.Close()
+
+	var product int
+	if err = rpcClient.Call("RPCTestArith.Multiply", &RPCTestArgs{7, 6}, &product); err == nil {
+		t.Errorf("RPC call that failed to send succeeded")
+	}
+	if n := pendingRPCCalls(codec); n != 0 {
+		t.Errorf("%d calls still pending after failing to send", n)
+	}
+}
+
+func TestRPCIgnoresForgedReply(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+	server, err := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	if err != nil {
+		t.Fatalf("Creating server failed with %s", err)
+	}
+	client, err := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+	if err != nil {
+		t.Fatalf("Creating client failed with %s", err)
+	}
+
+	packetSocket, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed with %s", err)
+	}
+	defer packetSocket.Close()
+
+	// Answer the request with a forged reply carrying its DH parameter, then the real one
+	go func() {
+		rpcServer := rpc.NewServer()
+		rpcServer.Register(new(RPCTestArith))
+
+		buf := make([]byte, rpcMaxPacketSize)
+		n, addr, err := packetSocket.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		forged := make([]byte, n)
+		copy(forged, buf[:n])
+		forged[0] |= 0x80
+		forged[len(forged)-1] ^= 1
+		packetSocket.WriteTo(forged, addr)
+
+		serverCodec := NewRPCServerCodec(server, &rpcReplayConn{packetSocket, buf[:n], addr})
+		rpcServer.ServeRequest(serverCodec)
+	}()
+
+	rpcClient, err := DialRPC("udp", packetSocket.LocalAddr().String(), client, time.Second)
+	if err != nil {
+		t.Fatalf("Dialing RPC server failed with %s", err)
+	}
+	defer rpcClient.Close()
+
+	var product int
+	if err = rpcClient.Call("RPCTestArith.Multiply", &RPCTestArgs{7, 6}, &product); err != nil {
+		t.Fatalf("RPC call failed with %s", err)
+	}
+	if product != 42 {
+		t.Errorf("RPC call returned %d", product)
+	}
+}
+
+// rpcReplayConn delivers a packet that has already been read before reading from PacketConn.
+type rpcReplayConn struct {
+	net.PacketConn
+	packet []byte
+	addr   net.Addr
+}
+
+func (c *rpcReplayConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	if c.packet == nil {
+		return c.PacketConn.ReadFrom(b)
+	}
+	n, addr = copy(b, c.packet), c.addr
+	c.packet = nil
+	return
+}
+
+func TestRPCConcurrentCalls(t *testing.T) {
+	serverPrivateKey, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+	server, err := NewServer(CipherSuiteX25519AESGCM, serverPrivateKey)
+	if err != nil {
+		t.Fatalf("Creating server failed with %s", err)
+	}
+	client, err := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+	if err != nil {
+		t.Fatalf("Creating client failed with %s", err)
+	}
+
+	packetSocket, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed with %s", err)
+	}
+	defer packetSocket.Close()
+
+	// Both requests are read before either is answered, so they must not share a buffer
+	const calls = 2
+	barrier := &RPCTestBarrier{}
+	barrier.arrived.Add(calls)
+	rpcServer := rpc.NewServer()
+	if err = rpcServer.Register(barrier); err != nil {
+		t.Fatalf("Registering RPC service failed with %s", err)
+	}
+	go rpcServer.ServeCodec(NewRPCServerCodec(server, packetSocket))
+
+	rpcClient, err := DialRPC("udp", packetSocket.LocalAddr().String(), client, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Dialing RPC server failed with %s", err)
+	}
+	defer rpcClient.Close()
+
+	products := make([]int, calls)
+	pending := make([]*rpc.Call, calls)
+	for i := range pending {
+		pending[i] = rpcClient.Go("RPCTestBarrier.Multiply", &RPCTestArgs{i + 2, 10}, &products[i], nil)
+	}
+	for i, call := range pending {
+		<-call.Done
+		if call.Error != nil {
+			t.Errorf("Concurrent RPC call %d failed with %s", i, call.Error)
+		} else if products[i] != (i+2)*10 {
+			t.Errorf("Concurrent RPC call %d returned %d", i, products[i])
+		}
+	}
+}
+
+func TestRPCRejectsBadTimeout(t *testing.T) {
+	_, serverPublicKey, err := GenerateKeyPair(CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		t.Fatalf("Generate server key failed with %s", err)
+	}
+	client, err := NewClient(CipherSuiteX25519AESGCM, serverPublicKey, nil)
+	if err != nil {
+		t.Fatalf("Creating client failed with %s", err)
+	}
+
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		if _, err = NewRPCClientCodec(client, nil, timeout); err == nil {
+			t.Errorf("Timeout %s accepted", timeout)
+		}
+	}
+}
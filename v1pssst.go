@@ -3,20 +3,26 @@ package gopssst
 import (
 	"bytes"
 	"crypto"
-	"encoding/binary"
 	"io"
+	"time"
 
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/rand"
 	"crypto/sha256"
 
 	"golang.org/x/crypto/curve25519"
 )
 
+// The smallest valid packet is a header, DH param and an AES-GCM tag, with 64 more bytes of payload for client auth.
+const (
+	minPacketSizeX25519AESGCM128           = 36 + 16
+	minPacketSizeClientAuthX25519AESGCM128 = minPacketSizeX25519AESGCM128 + 64
+)
+
 type serverX22519AESGCM128 struct {
 	ServerPrivateKey []byte
-	serverPublicKey []byte
+	serverPublicKey  []byte
+	metrics          Metrics
 }
 
 type clientX25519AESGCM128 struct {
@@ -24,11 +30,14 @@ type clientX25519AESGCM128 struct {
 	ClientPrivateKey      []byte
 	clientPublicKey       []byte
 	clientServerPublicKey []byte
+	ephemeralPool         *ephemeralPool
+	metrics               Metrics
+	random                io.Reader
 }
 
 func generateX22519Private(random io.Reader) (privateKey []byte, err error) {
 	if random == nil {
-		random = rand.Reader
+		random = defaultRandom()
 	}
 
 	var priv [32]byte
@@ -60,6 +69,13 @@ func generateX22519Pair(random io.Reader) ([]byte, []byte, error) {
 	return priv, pub, err
 }
 
+/*
+kdfX25519AESGCM128 derives the AES key and both nonces from a single hash. The reply
+nonce is derived even for requests that are never answered: it is 12 bytes taken from a
+hash that has to be computed for the request anyway, and the reply is sealed with the
+AEAD that opened the request, so there is no reply-only setup worth deferring to the
+reply handler.
+*/
 func kdfX25519AESGCM128(dhParam []byte, sharedSecret []byte) (key []byte, iv_c []byte, iv_s []byte) {
 	kdfHash := sha256.New()
 	kdfHash.Write(dhParam)
@@ -77,49 +93,105 @@ func kdfX25519AESGCM128(dhParam []byte, sharedSecret []byte) (key []byte, iv_c [
 	return
 }
 
-func (client *clientX25519AESGCM128) PackOutgoing(data []byte) (packetBytes []byte, replyHandler ReplyHandler, err error) {
-	var dhParam, sharedSecret []byte
+/*
+newServerX25519AESGCM128 creates a server and computes its public key up front, so that
+the server is never modified after construction and is safe for concurrent use.
+*/
+func newServerX25519AESGCM128(serverPrivateKey []byte, config *serverConfig) (server *serverX22519AESGCM128, err error) {
+	server = &serverX22519AESGCM128{ServerPrivateKey: serverPrivateKey, metrics: config.metrics}
+	if server.serverPublicKey, err = curve25519.X25519(serverPrivateKey, curve25519.Basepoint); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+/*
+newClientX25519AESGCM128 creates a client, taking the client public key and the static
+client-server DH value from the identity up front when client auth is used. As with the
+server, the client is then immutable and safe for concurrent use.
+*/
+func newClientX25519AESGCM128(serverPublicKey []byte, identity *ClientIdentity, config *clientConfig) (client *clientX25519AESGCM128, err error) {
+	client = &clientX25519AESGCM128{ServerPublicKey: serverPublicKey, metrics: config.metrics, random: config.random}
+
+	if identity != nil {
+		client.ClientPrivateKey = identity.privateKey
+		client.clientPublicKey = identity.publicKey
+		if client.clientServerPublicKey, err = identity.staticDHWith(serverPublicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.ephemeralPoolSize > 0 {
+		base, peer := client.ephemeralBase()
+		client.ephemeralPool = newEphemeralPool(config.ephemeralPoolSize, base, peer, config.random)
+	}
+
+	return
+}
 
-	var sessionSecret []byte
+// ephemeralKey holds a session secret and the results of the DH operations it is used in.
+type ephemeralKey struct {
+	sessionSecret, dhParam, sharedSecret []byte
+}
 
-	if sessionSecret, err = generateX22519Private(nil); err != nil {
+/*
+newEphemeralKey generates a session secret from random and multiplies it by base, to
+form the DH param, and by peer, to form the shared secret. Without client auth base is the curve
+base point and peer the server public key; with client auth they are the client public
+key and the client-server static DH value.
+*/
+func newEphemeralKey(base, peer []byte, random io.Reader, timer *stageTimer) (key ephemeralKey, err error) {
+	if key.sessionSecret, err = generateX22519Private(random); err != nil {
+		return
+	}
+	timer.end(StageKeyGen)
+	if key.dhParam, err = curve25519.X25519(key.sessionSecret, base); err != nil {
 		return
 	}
+	if key.sharedSecret, err = curve25519.X25519(key.sessionSecret, peer); err != nil {
+		return
+	}
+	timer.end(StageDH)
+
+	return
+}
+
+func (client *clientX25519AESGCM128) ephemeralBase() (base, peer []byte) {
+	if client.ClientPrivateKey != nil {
+		return client.clientPublicKey, client.clientServerPublicKey
+	}
+	return curve25519.Basepoint, client.ServerPublicKey
+}
+
+func (client *clientX25519AESGCM128) PackOutgoing(data []byte) (packetBytes []byte, replyHandler ReplyHandler, err error) {
+	if client.metrics != nil {
+		defer observeOperation(client.metrics, OperationPack, time.Now(), &err)
+	}
 
 	requestHeader := header{0, CipherSuiteX25519AESGCM}
 
 	if client.ClientPrivateKey != nil {
 		requestHeader.Flags |= flagsClientAuth
-		if client.clientPublicKey == nil {
-			if client.clientPublicKey, err = curve25519.X25519(client.ClientPrivateKey, curve25519.Basepoint); err != nil {
-				return
-			}
-			if client.clientServerPublicKey, err = curve25519.X25519(client.ClientPrivateKey, client.ServerPublicKey); err != nil {
-				return
-			}
-		}
-		if dhParam, err = curve25519.X25519(sessionSecret, client.clientPublicKey); err != nil {
-			return
-		}
-		if sharedSecret, err = curve25519.X25519(sessionSecret, client.clientServerPublicKey); err != nil {
-			return
-		}
+	}
 
-		extendedData := make([]byte, len(data)+64)
-		copy(extendedData[:32], client.clientPublicKey)
-		copy(extendedData[32:64], sessionSecret)
-		copy(extendedData[64:], data)
-		data = extendedData
+	timer := startStages(client.metrics)
+
+	var ephemeral ephemeralKey
+	if client.ephemeralPool != nil {
+		ephemeral, err = client.ephemeralPool.get(&timer)
 	} else {
-		if dhParam, err = curve25519.X25519(sessionSecret, curve25519.Basepoint); err != nil {
-			return
-		}
-		if sharedSecret, err = curve25519.X25519(sessionSecret, client.ServerPublicKey); err != nil {
-			return
-		}
+		base, peer := client.ephemeralBase()
+		ephemeral, err = newEphemeralKey(base, peer, client.random, &timer)
+	}
+	if err != nil {
+		return
 	}
 
+	dhParam, sharedSecret := ephemeral.dhParam, ephemeral.sharedSecret
+
 	symetricKey, clientNonce, serverNonce := kdfX25519AESGCM128(dhParam, sharedSecret)
+	timer.end(StageKDF)
 
 	var block cipher.Block
 	var aesgcm cipher.AEAD
@@ -131,27 +203,44 @@ func (client *clientX25519AESGCM128) PackOutgoing(data []byte) (packetBytes []by
 		return
 	}
 
-	packetBuffer := new(bytes.Buffer)
-	if err = binary.Write(packetBuffer, binary.BigEndian, requestHeader); err != nil {
-		return
+	plaintextLength := len(data)
+	if client.ClientPrivateKey != nil {
+		plaintextLength += 64
 	}
 
-	packetBuffer.Write(dhParam)
+	// The packet size is known up front so the header, DH param and ciphertext
+	// are all written into a single allocation.
+	packetBytes = make([]byte, 36, 36+plaintextLength+aesgcm.Overhead())
+	requestHeader.encode(packetBytes[:headerSize])
+	copy(packetBytes[4:36], dhParam)
+
+	plaintext := data
+	if client.ClientPrivateKey != nil {
+		// The client public key and session secret are prepended to the data. The
+		// plaintext is assembled where the ciphertext will go and sealed in place.
+		plaintext = packetBytes[36 : 36+plaintextLength]
+		copy(plaintext[:32], client.clientPublicKey)
+		copy(plaintext[32:64], ephemeral.sessionSecret)
+		copy(plaintext[64:], data)
+	}
 
-	ciphertext := aesgcm.Seal(nil, clientNonce, data, packetBuffer.Bytes()[:4])
-	packetBuffer.Write(ciphertext)
+	packetBytes = aesgcm.Seal(packetBytes, clientNonce, plaintext, packetBytes[:4])
+	timer.end(StageAEAD)
 
 	// Construct reply context with DH param and shared secret
 
 	replyHandler = func(replyPacketBytes []byte) (data []byte, err error) {
+		if client.metrics != nil {
+			defer observeOperation(client.metrics, OperationUnpackReply, time.Now(), &err)
+		}
+
 		if aesgcm == nil {
 			err = &PSSSTError{"reply handler already used"}
 			return
 		}
 
 		var replyHeader header
-		replyPacketBuffer := bytes.NewReader(replyPacketBytes)
-		if err = binary.Read(replyPacketBuffer, binary.BigEndian, &replyHeader); err != nil {
+		if replyHeader, err = decodeHeader(replyPacketBytes); err != nil {
 			return
 		}
 
@@ -167,37 +256,41 @@ func (client *clientX25519AESGCM128) PackOutgoing(data []byte) (packetBytes []by
 			err = &PSSSTError{"Unsuported cipher suite"}
 			return
 		}
+		if len(replyPacketBytes) < minPacketSizeX25519AESGCM128 {
+			err = &PSSSTError{"Packet too short"}
+			return
+		}
 		if !bytes.Equal(replyPacketBytes[4:36], dhParam) {
 			err = &PSSSTError{"Request/reply mismatch"}
 			return
 		}
 
+		timer := startStages(client.metrics)
 		data, err = aesgcm.Open(nil, serverNonce, replyPacketBytes[36:], replyPacketBytes[:4])
+		timer.end(StageAEAD)
+		if err != nil {
+			// A forged or corrupted reply leaves the handler usable for the real one
+			return
+		}
 		aesgcm = nil
 
 		return
 	}
 
-	packetBytes = packetBuffer.Bytes()
-
 	return
 }
 
 func (server *serverX22519AESGCM128) GetServerPublicKey() (key crypto.PublicKey, err error) {
-	if server.serverPublicKey == nil {
-		server.serverPublicKey, err = curve25519.X25519(server.ServerPrivateKey, curve25519.Basepoint)
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	return server.serverPublicKey, nil
 }
 
 func (server *serverX22519AESGCM128) UnpackIncoming(packetBytes []byte) (data []byte, replyHandler ReplyHandler, clientPublicKey crypto.PublicKey, err error) {
+	if server.metrics != nil {
+		defer observeOperation(server.metrics, OperationUnpack, time.Now(), &err)
+	}
+
 	var requestHeader header
-	packetBuffer := bytes.NewReader(packetBytes)
-	if err = binary.Read(packetBuffer, binary.BigEndian, &requestHeader); err != nil {
+	if requestHeader, err = decodeHeader(packetBytes); err != nil {
 		return
 	}
 
@@ -213,15 +306,32 @@ func (server *serverX22519AESGCM128) UnpackIncoming(packetBytes []byte) (data []
 		return
 	}
 
-	dhParam := packetBytes[4:36]
+	minPacketSize := minPacketSizeX25519AESGCM128
+	if hasClientAuth {
+		minPacketSize = minPacketSizeClientAuthX25519AESGCM128
+	}
+	if len(packetBytes) < minPacketSize {
+		err = &PSSSTError{"Packet too short"}
+		return
+	}
+
+	// Everything above is cheap. From here on each packet costs at least an X25519
+	// operation, a SHA-256 and an AES-GCM open before it can be rejected.
+
+	// The reply handler keeps the DH param, so copy it rather than hold on to the caller's packet
+	dhParam := append([]byte{}, packetBytes[4:36]...)
+
+	timer := startStages(server.metrics)
 
 	var sharedSecret []byte
 
 	if sharedSecret, err = curve25519.X25519(server.ServerPrivateKey, dhParam); err != nil {
 		return
 	}
+	timer.end(StageDH)
 
 	symetricKey, clientNonce, serverNonce := kdfX25519AESGCM128(dhParam, sharedSecret)
+	timer.end(StageKDF)
 
 	var block cipher.Block
 	var aesgcm cipher.AEAD
@@ -237,6 +347,7 @@ func (server *serverX22519AESGCM128) UnpackIncoming(packetBytes []byte) (data []
 	if payload, err = aesgcm.Open(nil, clientNonce, packetBytes[36:], packetBytes[:4]); err != nil {
 		return
 	}
+	timer.end(StageAEAD)
 
 	if hasClientAuth {
 		clientPublicKeyBytes := payload[:32]
@@ -250,6 +361,7 @@ func (server *serverX22519AESGCM128) UnpackIncoming(packetBytes []byte) (data []
 			err = &PSSSTError{"Client authentication failed"}
 			return
 		}
+		timer.end(StageDH)
 		clientPublicKey = clientPublicKeyBytes
 		data = payload[64:]
 	} else {
@@ -257,6 +369,10 @@ func (server *serverX22519AESGCM128) UnpackIncoming(packetBytes []byte) (data []
 	}
 
 	replyHandler = func(data []byte) (reply []byte, err error) {
+		if server.metrics != nil {
+			defer observeOperation(server.metrics, OperationReply, time.Now(), &err)
+		}
+
 		if aesgcm == nil {
 			err = &PSSSTError{"reply handler already used"}
 			return
@@ -267,20 +383,17 @@ func (server *serverX22519AESGCM128) UnpackIncoming(packetBytes []byte) (data []
 			replyHeader.Flags |= flagsClientAuth
 		}
 
-		packetBuffer := new(bytes.Buffer)
-
-		if err = binary.Write(packetBuffer, binary.BigEndian, replyHeader); err != nil {
-			return
-		}
+		timer := startStages(server.metrics)
 
-		packetBuffer.Write(dhParam)
+		reply = make([]byte, 36, 36+len(data)+aesgcm.Overhead())
+		replyHeader.encode(reply[:headerSize])
+		copy(reply[4:36], dhParam)
 
-		ciphertext := aesgcm.Seal(nil, serverNonce, data, packetBuffer.Bytes()[:4])
-		packetBuffer.Write(ciphertext)
+		reply = aesgcm.Seal(reply, serverNonce, data, reply[:4])
+		timer.end(StageAEAD)
 
 		aesgcm = nil
 
-		reply = packetBuffer.Bytes()
 		return
 	}
 
@@ -0,0 +1,160 @@
+//go:build js && wasm
+// +build js,wasm
+
+/*
+Command wasm exposes PSSST to JavaScript when built for GOOS=js GOARCH=wasm. After
+the module is started with wasm_exec.js it sets a global pssst object with these
+functions, all taking and returning Uint8Array values:
+
+	pssst.generateKeyPair() -> {privateKey, publicKey}
+	pssst.newClient(serverPublicKey[, clientPrivateKey]) -> client
+	client.pack(data) -> {packet, unpackReply(replyPacket) -> data}
+	pssst.newServer(serverPrivateKey) -> server
+	server.publicKey
+	server.unpack(packet) -> {data, clientPublicKey, reply(data) -> replyPacket}
+
+Failures are returned as Error objects rather than thrown, since a Go panic would stop
+the module. unpackReply and reply may each succeed once, after which their Go side is
+released; a call that fails, for instance on a forged reply, leaves them usable. Randomness comes from crypto.getRandomValues through crypto/rand.
+*/
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/nickovs/gopssst"
+)
+
+func toBytes(v js.Value) []byte {
+	b := make([]byte, v.Get("length").Int())
+	js.CopyBytesToGo(b, v)
+	return b
+}
+
+func toUint8Array(b []byte) js.Value {
+	v := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(v, b)
+	return v
+}
+
+func jsError(err error) js.Value {
+	return js.Global().Get("Error").New(err.Error())
+}
+
+func argumentError(message string) js.Value {
+	return js.Global().Get("TypeError").New(message)
+}
+
+func isUint8Array(v js.Value) bool {
+	return v.InstanceOf(js.Global().Get("Uint8Array"))
+}
+
+// onceFunc wraps a reply handler as a JavaScript function that releases itself after its first successful call.
+func onceFunc(handler gopssst.ReplyHandler) js.Func {
+	var f js.Func
+	f = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) != 1 || !isUint8Array(args[0]) {
+			return argumentError("expected a Uint8Array")
+		}
+		result, err := handler(toBytes(args[0]))
+		if err != nil {
+			return jsError(err)
+		}
+		f.Release()
+		return toUint8Array(result)
+	})
+	return f
+}
+
+func generateKeyPair(this js.Value, args []js.Value) interface{} {
+	privateKey, publicKey, err := gopssst.GenerateKeyPair(gopssst.CipherSuiteX25519AESGCM, nil)
+	if err != nil {
+		return jsError(err)
+	}
+	return map[string]interface{}{
+		"privateKey": toUint8Array(privateKey.([]byte)),
+		"publicKey":  toUint8Array(publicKey.([]byte)),
+	}
+}
+
+func newClient(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 || !isUint8Array(args[0]) {
+		return argumentError("expected the server public key as a Uint8Array")
+	}
+
+	var client gopssst.Client
+	var err error
+	if len(args) > 1 && isUint8Array(args[1]) {
+		client, err = gopssst.NewClient(gopssst.CipherSuiteX25519AESGCM, toBytes(args[0]), toBytes(args[1]))
+	} else {
+		client, err = gopssst.NewClient(gopssst.CipherSuiteX25519AESGCM, toBytes(args[0]), nil)
+	}
+	if err != nil {
+		return jsError(err)
+	}
+
+	pack := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) != 1 || !isUint8Array(args[0]) {
+			return argumentError("expected the request data as a Uint8Array")
+		}
+		packetBytes, replyHandler, err := client.PackOutgoing(toBytes(args[0]))
+		if err != nil {
+			return jsError(err)
+		}
+		return map[string]interface{}{
+			"packet":      toUint8Array(packetBytes),
+			"unpackReply": onceFunc(replyHandler),
+		}
+	})
+
+	return map[string]interface{}{"pack": pack}
+}
+
+func newServer(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 || !isUint8Array(args[0]) {
+		return argumentError("expected the server private key as a Uint8Array")
+	}
+
+	server, err := gopssst.NewServer(gopssst.CipherSuiteX25519AESGCM, toBytes(args[0]))
+	if err != nil {
+		return jsError(err)
+	}
+	publicKey, err := server.GetServerPublicKey()
+	if err != nil {
+		return jsError(err)
+	}
+
+	unpack := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) != 1 || !isUint8Array(args[0]) {
+			return argumentError("expected the request packet as a Uint8Array")
+		}
+		data, replyHandler, clientPublicKey, err := server.UnpackIncoming(toBytes(args[0]))
+		if err != nil {
+			return jsError(err)
+		}
+		result := map[string]interface{}{
+			"data":            toUint8Array(data),
+			"clientPublicKey": js.Null(),
+			"reply":           onceFunc(replyHandler),
+		}
+		if clientPublicKey != nil {
+			result["clientPublicKey"] = toUint8Array(clientPublicKey.([]byte))
+		}
+		return result
+	})
+
+	return map[string]interface{}{
+		"publicKey": toUint8Array(publicKey.([]byte)),
+		"unpack":    unpack,
+	}
+}
+
+func main() {
+	js.Global().Set("pssst", map[string]interface{}{
+		"generateKeyPair": js.FuncOf(generateKeyPair),
+		"newClient":       js.FuncOf(newClient),
+		"newServer":       js.FuncOf(newServer),
+	})
+
+	select {}
+}
@@ -0,0 +1,38 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"bytes"
+	"syscall/js"
+	"testing"
+)
+
+func TestUnpackReplyRetryAfterFailure(t *testing.T) {
+	keys := js.ValueOf(generateKeyPair(js.Undefined(), nil))
+	server := js.ValueOf(newServer(js.Undefined(), []js.Value{keys.Get("privateKey")}))
+	client := js.ValueOf(newClient(js.Undefined(), []js.Value{keys.Get("publicKey")}))
+
+	request := client.Call("pack", toUint8Array([]byte("Hello")))
+	unpacked := server.Call("unpack", request.Get("packet"))
+	if unpacked.InstanceOf(js.Global().Get("Error")) {
+		t.Fatalf("Unpacking request failed with %s", unpacked.Get("message"))
+	}
+	reply := toBytes(unpacked.Call("reply", toUint8Array([]byte("World"))))
+
+	// A corrupted reply fails without using up unpackReply
+	corrupted := append([]byte{}, reply...)
+	corrupted[len(corrupted)-1] ^= 1
+	if result := request.Call("unpackReply", toUint8Array(corrupted)); !result.InstanceOf(js.Global().Get("Error")) {
+		t.Errorf("Corrupted reply accepted")
+	}
+
+	result := request.Call("unpackReply", toUint8Array(reply))
+	if result.InstanceOf(js.Global().Get("Error")) {
+		t.Fatalf("Retrying with the real reply failed with %s", result.Get("message"))
+	}
+	if !bytes.Equal(toBytes(result), []byte("World")) {
+		t.Errorf("Reply data did not match")
+	}
+}